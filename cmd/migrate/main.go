@@ -22,7 +22,7 @@ func main() {
 
 	// 3. Migrate
 	log.Println("Starting migration...")
-	err = database.DB.AutoMigrate(&models.User{}, &models.Client{})
+	err = database.DB.AutoMigrate(&models.User{}, &models.Client{}, &models.Consent{}, &models.APIResource{}, &models.PairwiseSubject{})
 	if err != nil {
 		log.Fatalf("Migration failed: %v", err)
 	}
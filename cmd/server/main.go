@@ -5,8 +5,12 @@ import (
 	"auth-system/internal/database"
 	"auth-system/internal/handlers"
 	"auth-system/internal/middleware"
+	"auth-system/internal/utils"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 
 	"github.com/gin-gonic/gin"
@@ -40,6 +44,14 @@ func main() {
 
 	// 4. Setup Handlers
 	h := handlers.NewHandler(cfg)
+	if cfg.TLSClientCAFile != "" {
+		h.ClientCAs, err = utils.LoadCertPool(cfg.TLSClientCAFile)
+		if err != nil {
+			slog.Error("Failed to load client CA certificates", "error", err)
+			os.Exit(1)
+		}
+	}
+	go h.RunBackchannelLogoutWorker(context.Background())
 
 	// 5. Setup Router
 	r := gin.New() // Use New() to avoid default middleware
@@ -51,14 +63,40 @@ func main() {
 	basePath := fmt.Sprintf("/api/%s/authorization-server", cfg.APIVersion)
 	api := r.Group(basePath)
 	{
+		api.GET("/.well-known/openid-configuration", h.OpenIDConfiguration)
+		api.GET("/.well-known/jwks.json", h.JWKS)
 		api.POST("/user/register", h.RegisterUser)
 		api.POST("/client/register", h.RegisterClient)
 		api.POST("/login", h.Login)
+		api.GET("/oauth/authorize", h.Authorize)
+		api.POST("/oauth/authorize", h.AuthorizeLogin)
+		api.POST("/oauth/authorize/consent", h.AuthorizeConsent)
+		api.POST("/oauth/par", h.PushedAuthorizationRequest)
 		api.POST("/logout", h.Logout)
+		api.GET("/oauth/logout", h.EndSession)
+		api.POST("/oauth/logout", h.EndSession)
 		api.POST("/oauth/token", h.OAuthToken)
 		api.POST("/oauth/refresh", h.OAuthRefresh)
+		api.POST("/oauth/introspect", h.Introspect)
+		api.POST("/oauth/revoke", h.Revoke)
+		api.POST("/oauth/device_authorization", h.DeviceAuthorization)
+		api.POST("/oauth/register", h.RegisterDynamicClient)
+		api.GET("/oauth/register/:client_id", h.GetClientRegistration)
+		api.PUT("/oauth/register/:client_id", h.UpdateClientRegistration)
+		api.DELETE("/oauth/register/:client_id", h.DeleteClientRegistration)
+		api.PATCH("/clients/:client_id/policy", h.UpdateClientPolicy)
+		api.POST("/resources", h.RegisterResource)
+		api.GET("/resources", h.ListResources)
+		api.DELETE("/resources/:id", h.DeleteResource)
+		api.GET("/device", h.DeviceVerification)
+		api.POST("/device", h.DeviceVerificationSubmit)
 		api.GET("/client/me", h.ClientMe)
+		api.PATCH("/client/me", h.UpdateClient)
 		api.GET("/user/me", h.UserMe)
+		api.GET("/userinfo", h.UserInfo)
+		api.POST("/userinfo", h.UserInfo)
+		api.GET("/user/consents", h.ListConsents)
+		api.DELETE("/user/consents/:client_id", h.RevokeConsent)
 		api.POST("/user/verify", h.VerifyEmail)
 		api.POST("/user/verify/resend", h.ResendVerificationCode)
 		api.POST("/user/password/forgot", h.ForgotPassword)
@@ -67,6 +105,24 @@ func main() {
 
 	// 6. Start Server
 	addr := fmt.Sprintf(":%s", cfg.ServerPort)
+	if cfg.TLSCertFile != "" {
+		// Client certificates are requested but verified per client, as self-signed certificates are allowed
+		srv := &http.Server{
+			Addr:    addr,
+			Handler: r,
+			TLSConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				ClientAuth: tls.RequestClientCert,
+			},
+		}
+		slog.Info("Server starting with TLS", "address", addr)
+		if err := srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile); err != nil {
+			slog.Error("Server failed to start", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	slog.Info("Server starting", "address", addr)
 	if err := r.Run(addr); err != nil {
 		slog.Error("Server failed to start", "error", err)
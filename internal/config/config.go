@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -19,11 +20,19 @@ type Config struct {
 	ServerPort      string
 	JWTSecret       string
 	AccessTokenExp      int
+	TokenLeewaySeconds  int
 	RefreshTokenExp     int
 	AuthCodeExp         int
+	SessionExpHours     int
 	PasswordResetExpHours int
 	APIVersion          string
 	EncryptionKey       string
+	Issuer              string
+	RegistrationInitialAccessToken string
+	PairwiseSubjectSalt string
+	TLSCertFile         string
+	TLSKeyFile          string
+	TLSClientCAFile     string
 }
 
 func LoadConfig(strict bool) (*Config, error) {
@@ -78,6 +87,12 @@ func LoadConfig(strict bool) (*Config, error) {
 		if err != nil { return nil, fmt.Errorf("ACCESS_TOKEN_EXP_MINUTES must be an integer") }
 	}
 
+	// Optional: clock skew tolerated when validating access tokens
+	if leewayStr, _ := getEnv("TOKEN_LEEWAY_SECONDS"); leewayStr != "" {
+		cfg.TokenLeewaySeconds, err = strconv.Atoi(leewayStr)
+		if err != nil { return nil, fmt.Errorf("TOKEN_LEEWAY_SECONDS must be an integer") }
+	}
+
 	refreshTokenStr, err := getEnvOrSkip("REFRESH_TOKEN_EXP_DAYS")
 	if err != nil { return nil, err }
 	if refreshTokenStr != "" {
@@ -92,6 +107,12 @@ func LoadConfig(strict bool) (*Config, error) {
 		if err != nil { return nil, fmt.Errorf("AUTH_CODE_EXP_MINUTES must be an integer") }
 	}
 
+	// Optional: lifetime of the browser SSO session, defaults to 24 hours
+	if sessionStr, _ := getEnv("SESSION_EXP_HOURS"); sessionStr != "" {
+		cfg.SessionExpHours, err = strconv.Atoi(sessionStr)
+		if err != nil { return nil, fmt.Errorf("SESSION_EXP_HOURS must be an integer") }
+	}
+
 	passwordResetStr, err := getEnvOrSkip("PASSWORD_RESET_EXP_HOURS")
 	if err != nil { return nil, err }
 	if passwordResetStr != "" {
@@ -105,6 +126,22 @@ func LoadConfig(strict bool) (*Config, error) {
 	cfg.EncryptionKey, err = getEnvOrSkip("ENCRYPTION_KEY")
 	if err != nil { return nil, err }
 
+	// Public base URL of the API, e.g. https://auth.example.com/api/v1/authorization-server
+	cfg.Issuer, err = getEnvOrSkip("ISSUER_URL")
+	if err != nil { return nil, err }
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+
+	// Optional: dynamic client registration is disabled without it
+	cfg.RegistrationInitialAccessToken, _ = getEnv("REGISTRATION_INITIAL_ACCESS_TOKEN")
+
+	// Optional: clients cannot use pairwise subject identifiers without it
+	cfg.PairwiseSubjectSalt, _ = getEnv("PAIRWISE_SUBJECT_SALT")
+
+	// Optional: serve TLS and request client certificates for mutual-TLS client authentication
+	cfg.TLSCertFile, _ = getEnv("TLS_CERT_FILE")
+	cfg.TLSKeyFile, _ = getEnv("TLS_KEY_FILE")
+	cfg.TLSClientCAFile, _ = getEnv("TLS_CLIENT_CA_FILE")
+
 	return cfg, nil
 }
 
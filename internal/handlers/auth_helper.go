@@ -3,29 +3,244 @@ package handlers
 import (
 	"auth-system/internal/models"
 	"auth-system/internal/utils"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
-func (h *Handler) authenticateClient(c *gin.Context) (*models.Client, bool) {
-	clientID, clientSecret, ok := c.Request.BasicAuth()
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(c *gin.Context) (string, bool) {
+	parts := strings.Split(c.GetHeader("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != "Bearer" || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// formAccessToken returns the access_token parameter of a form-encoded POST body (RFC 6750 Section 2.2)
+func formAccessToken(c *gin.Context) (string, bool) {
+	if c.Request.Method != http.MethodPost || c.ContentType() != "application/x-www-form-urlencoded" {
+		return "", false
+	}
+	token := c.PostForm("access_token")
+	return token, token != ""
+}
+
+// authenticateAccessToken validates the Bearer or DPoP access token of the request, including its DPoP binding.
+// A bearer token may also be sent in a form-encoded POST body instead of the Authorization header.
+// On failure it responds with Unauthorized and an RFC 6750 challenge, and returns false.
+func (h *Handler) authenticateAccessToken(c *gin.Context) (jwt.MapClaims, *models.Client, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if token, ok := formAccessToken(c); ok {
+		if authHeader != "" {
+			setAuthenticateChallenge(c, "Bearer", "invalid_request", "Only one method may be used to send the access token")
+			h.RespondError(c, http.StatusBadRequest, nil, "Only one method may be used to send the access token")
+			return nil, nil, false
+		}
+		authHeader = "Bearer " + token
+	}
+	if authHeader == "" {
+		setAuthenticateChallenge(c, "Bearer", "", "")
+		h.RespondError(c, http.StatusUnauthorized, nil, "Authorization header required")
+		return nil, nil, false
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || (parts[0] != "Bearer" && parts[0] != "DPoP") {
+		setAuthenticateChallenge(c, "Bearer", "invalid_request", "Invalid authorization format")
+		h.RespondError(c, http.StatusUnauthorized, nil, "Invalid authorization format")
+		return nil, nil, false
+	}
+
+	claims, client, err := h.validateAccessToken(c, parts[1])
+	if err != nil {
+		setAuthenticateChallenge(c, parts[0], "invalid_token", "Invalid token")
+		h.RespondError(c, http.StatusUnauthorized, err, "Invalid token")
+		return nil, nil, false
+	}
+	// The server's own endpoints only accept tokens addressed to the client, not to an API resource or exchange audience
+	if !tokenAddressedTo(claims, client.ID.String()) {
+		setAuthenticateChallenge(c, parts[0], "invalid_token", "The token is not addressed to this server")
+		h.RespondError(c, http.StatusUnauthorized, nil, "Invalid token")
+		return nil, nil, false
+	}
+
+	if !h.checkAccessTokenBinding(c, parts[0], parts[1], claims) || !h.checkCertificateBinding(c, claims) {
+		return nil, nil, false
+	}
+
+	return claims, client, true
+}
+
+// authenticateUser authenticates the access token of the request like authenticateAccessToken and returns the ID of
+// the user it was issued for, mapping a pairwise sub back. Tokens whose sub is not a user are rejected as invalid.
+func (h *Handler) authenticateUser(c *gin.Context) (jwt.MapClaims, string, bool) {
+	claims, client, ok := h.authenticateAccessToken(c)
 	if !ok {
-		h.RespondError(c, http.StatusUnauthorized, nil, "Basic auth required")
-		return nil, false
+		return nil, "", false
+	}
+
+	subject, _ := claims["sub"].(string)
+	userID, err := h.subjectUserID(c, client, subject)
+	if errors.Is(err, errUnknownSubject) {
+		setAuthenticateChallenge(c, "Bearer", "invalid_token", "The token subject is not a user")
+		h.RespondError(c, http.StatusUnauthorized, err, "Invalid token")
+		return nil, "", false
+	}
+	if err != nil {
+		h.RespondInternalError(c, err, 22003)
+		return nil, "", false
+	}
+	return claims, userID, true
+}
+
+// requireScope checks that an authenticated access token was granted the scope,
+// responding with an insufficient_scope error when it was not
+func (h *Handler) requireScope(c *gin.Context, claims jwt.MapClaims, scope string) bool {
+	granted, _ := claims["scope"].(string)
+	if utils.HasScope(granted, scope) {
+		return true
 	}
+	setAuthenticateChallenge(c, authorizationScheme(c), "insufficient_scope", "The access token requires the "+scope+" scope")
+	h.RespondError(c, http.StatusForbidden, nil, "The access token was not granted the "+scope+" scope")
+	return false
+}
 
+// authorizationScheme returns the scheme the request presented its access token with
+func authorizationScheme(c *gin.Context) string {
+	if scheme, _, _ := strings.Cut(c.GetHeader("Authorization"), " "); scheme == "DPoP" {
+		return scheme
+	}
+	return "Bearer"
+}
+
+// setAuthenticateChallenge sets the WWW-Authenticate challenge of RFC 6750 Section 3.
+// Without an error code the challenge only names the scheme, as for requests without credentials.
+func setAuthenticateChallenge(c *gin.Context, scheme, code, description string) {
+	challenge := scheme
+	if code != "" {
+		challenge += ` error="` + code + `"`
+		if description != "" {
+			challenge += `, error_description="` + description + `"`
+		}
+	}
+	c.Header("WWW-Authenticate", challenge)
+}
+
+// errInvalidAccessToken wraps the reasons an access token is rejected, telling them apart from failures to check it
+var errInvalidAccessToken = errors.New("invalid access token")
+
+// validateAccessToken verifies an access token against the public key of the client named by its client_id claim.
+// The token must be addressed to that client, to an audience the client may exchange tokens into or to an
+// API resource the client may use; callers protecting the server's own endpoints narrow this to the client.
+// Tokens that fail validation are reported with an error wrapping errInvalidAccessToken.
+func (h *Handler) validateAccessToken(ctx context.Context, tokenString string) (jwt.MapClaims, *models.Client, error) {
+	invalid := func(err error) error {
+		return fmt.Errorf("%w: %w", errInvalidAccessToken, err)
+	}
+
+	// 1. Parse Unverified to get Client ID
+	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return nil, nil, invalid(err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, nil, invalid(errors.New("invalid token claims"))
+	}
+
+	clientID, ok := claims["client_id"].(string)
+	if !ok {
+		return nil, nil, invalid(errors.New("invalid token claims: client_id"))
+	}
+
+	// 2. Fetch Client Public Key
 	var client models.Client
-	if err := h.DB.Where("id = ?", clientID).First(&client).Error; err != nil {
-		h.RespondError(c, http.StatusUnauthorized, err, "Invalid Client")
-		return nil, false
+	if err := h.DB.WithContext(ctx).Where("id = ?", clientID).First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, invalid(err)
+		}
+		return nil, nil, err
+	}
+
+	// 3. Validate Token with Public Key
+	validToken, validClaims, err := utils.ValidateAccessToken(tokenString, client.PublicKey, utils.AccessTokenValidation{
+		Issuer:    h.Config.Issuer,
+		Audiences: slices.Concat([]string{client.ID.String()}, client.TokenExchangeAudiences, client.AllowedResources),
+		Leeway:    time.Duration(h.Config.TokenLeewaySeconds) * time.Second,
+	})
+	if err != nil {
+		return nil, nil, invalid(err)
+	}
+	if !validToken.Valid {
+		return nil, nil, invalid(errors.New("invalid token"))
+	}
+
+	// 4. Check Revocation
+	if jti, ok := validClaims["jti"].(string); ok {
+		revoked, err := h.isAccessTokenRevoked(ctx, jti)
+		if err != nil {
+			return nil, nil, err
+		}
+		if revoked {
+			return nil, nil, invalid(errors.New("token revoked"))
+		}
+	}
+
+	return validClaims, &client, nil
+}
+
+// isAccessTokenRevoked reports whether the access token with the given jti was revoked
+func (h *Handler) isAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	// Key format: revoked_access_token:{jti}
+	exists, err := h.RedisClient.Exists(ctx, "revoked_access_token:"+jti).Result()
+	if err != nil {
+		return false, err
+	}
+	return exists > 0, nil
+}
+
+// isRefreshTokenBlocked reports whether the refresh token was blocked by Logout or revocation
+func (h *Handler) isRefreshTokenBlocked(ctx context.Context, refreshToken string) (bool, error) {
+	// Key format: blocked_refresh_token:{refresh_token}
+	exists, err := h.RedisClient.Exists(ctx, "blocked_refresh_token:"+refreshToken).Result()
+	if err != nil {
+		return false, err
+	}
+	return exists > 0, nil
+}
+
+// blockRefreshToken blocks the refresh token in Redis until it expires, together with its rotation family
+func (h *Handler) blockRefreshToken(ctx context.Context, refreshToken string, claims jwt.MapClaims) (time.Duration, error) {
+	if err := h.revokeRefreshFamily(ctx, claims); err != nil {
+		return 0, err
 	}
 
-	// Compare Hash
-	if !utils.CheckPassword(clientSecret, client.Secret) {
-		h.RespondError(c, http.StatusUnauthorized, nil, "Invalid Client Secret")
-		return nil, false
+	// Calculate TTL
+	var ttl time.Duration
+	if exp, ok := claims["exp"].(float64); ok {
+		expTime := time.Unix(int64(exp), 0)
+		ttl = time.Until(expTime)
+		if ttl <= 0 {
+			// Already expired: nothing to block, and go-redis would keep a key with a negative TTL forever
+			return 0, nil
+		}
+	} else {
+		// If exp claim is missing, block indefinitely.
+		// In go-redis, a duration of 0 means the key has no expiration time (persistent).
+		ttl = 0
 	}
 
-	return &client, true
+	// Key format: blocked_refresh_token:{refresh_token}
+	key := "blocked_refresh_token:" + refreshToken
+	return ttl, h.RedisClient.Set(ctx, key, "blocked", ttl).Err()
 }
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"auth-system/internal/middleware"
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	State               string `form:"state"`
+	Scope               string `form:"scope"`
+	Nonce               string `form:"nonce"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+	Resource            string `form:"resource"`    // RFC 8707 resource indicator
+	Prompt              string `form:"prompt"`      // Space separated: none, login or consent
+	MaxAge              string `form:"max_age"`     // Maximum seconds since the user last authenticated
+	RequestURI          string `form:"request_uri"` // Refers to a pushed authorization request or a request object
+	Request             string `form:"request"`     // Request object of RFC 9101
+
+	// Set while resolving the request, never bound from it. Pushed requests keep them in pushedRequest.
+	Pushed bool `form:"-" json:"-"`
+	Signed bool `form:"-" json:"-"`
+}
+
+type AuthorizeLoginForm struct {
+	AuthorizeRequest
+	Email    string `form:"email"`
+	Password string `form:"password"`
+}
+
+// authorizeError is an RFC 6749 Section 4.1.2.1 error.
+// When redirect is false the redirect_uri could not be trusted and the error is shown to the user agent instead.
+// Internal errors carry their unique error code.
+type authorizeError struct {
+	redirect     bool
+	code         string
+	description  string
+	err          error
+	internalCode int
+}
+
+type loginPage struct {
+	Title      string
+	Error      string
+	ClientName string
+	Email      string
+	Hidden     map[string]string
+	CSRFToken  string
+}
+
+// hiddenFields returns the authorization parameters to carry through the login form.
+// Pushed and signed requests only carry their reference, the parameters stay on the server.
+func (r *AuthorizeRequest) hiddenFields() map[string]string {
+	if r.RequestURI != "" {
+		return map[string]string{"client_id": r.ClientID, "request_uri": r.RequestURI}
+	}
+
+	fields := map[string]string{
+		"response_type":         r.ResponseType,
+		"client_id":             r.ClientID,
+		"redirect_uri":          r.RedirectURI,
+		"state":                 r.State,
+		"scope":                 r.Scope,
+		"nonce":                 r.Nonce,
+		"code_challenge":        r.CodeChallenge,
+		"code_challenge_method": r.CodeChallengeMethod,
+		"resource":              r.Resource,
+		"prompt":                r.Prompt,
+		"max_age":               r.MaxAge,
+	}
+	for k, v := range fields {
+		if v == "" {
+			delete(fields, k)
+		}
+	}
+	return fields
+}
+
+// hasPrompt reports whether the prompt parameter contains the value
+func (r *AuthorizeRequest) hasPrompt(value string) bool {
+	return slices.Contains(strings.Fields(r.Prompt), value)
+}
+
+// requiresLogin reports whether the user must sign in again rather than continue the SSO session,
+// because the client asked for it with prompt=login or the session is older than max_age
+func (r *AuthorizeRequest) requiresLogin(session *ssoSession) bool {
+	if r.hasPrompt("login") {
+		return true
+	}
+	if r.MaxAge == "" {
+		return false
+	}
+	maxAge, _ := strconv.ParseInt(r.MaxAge, 10, 64)
+	return time.Now().Unix()-session.AuthTime >= maxAge
+}
+
+// validateAuthorizeRequest checks the authorization request parameters and resolves the client
+func (h *Handler) validateAuthorizeRequest(ctx context.Context, req *AuthorizeRequest) (*models.Client, *authorizeError) {
+	if req.ClientID == "" {
+		return nil, &authorizeError{code: "invalid_request", description: "client_id is required"}
+	}
+
+	var client models.Client
+	if err := h.DB.WithContext(ctx).Where("id = ?", req.ClientID).First(&client).Error; err != nil {
+		return nil, &authorizeError{code: "invalid_client", description: "Unknown client"}
+	}
+
+	if req.RedirectURI == "" {
+		return nil, &authorizeError{code: "invalid_request", description: "redirect_uri is required"}
+	}
+	if !utils.MatchRedirectURI(client.RedirectURIs, req.RedirectURI) {
+		return nil, &authorizeError{code: "invalid_request", description: "redirect_uri is not registered for this client"}
+	}
+
+	// From here on errors are delivered to the client through the redirect_uri
+	if req.ResponseType != "code" {
+		return nil, &authorizeError{redirect: true, code: "unsupported_response_type", description: "Only response_type=code is supported"}
+	}
+	if !client.AllowsGrantType("authorization_code") {
+		return nil, &authorizeError{redirect: true, code: "unauthorized_client", description: "Client is not allowed to use the authorization code grant"}
+	}
+
+	if req.CodeChallenge == "" {
+		return nil, &authorizeError{redirect: true, code: "invalid_request", description: "code_challenge is required"}
+	}
+	if req.CodeChallengeMethod != "S256" {
+		return nil, &authorizeError{redirect: true, code: "invalid_request", description: "code_challenge_method must be S256"}
+	}
+
+	prompts := strings.Fields(req.Prompt)
+	for _, prompt := range prompts {
+		if prompt != "none" && prompt != "login" && prompt != "consent" {
+			return nil, &authorizeError{redirect: true, code: "invalid_request", description: "Unsupported prompt value " + prompt}
+		}
+	}
+	if req.hasPrompt("none") && len(prompts) > 1 {
+		return nil, &authorizeError{redirect: true, code: "invalid_request", description: "prompt=none cannot be combined with other values"}
+	}
+	if req.MaxAge != "" {
+		if maxAge, err := strconv.ParseInt(req.MaxAge, 10, 64); err != nil || maxAge < 0 {
+			return nil, &authorizeError{redirect: true, code: "invalid_request", description: "max_age must be a non-negative integer"}
+		}
+	}
+
+	// Grant the requested scope, or every scope the client is allowed when none is requested
+	if req.Scope == "" {
+		req.Scope = client.Scopes
+	}
+	if !utils.ScopeSubset(req.Scope, client.Scopes) {
+		return nil, &authorizeError{redirect: true, code: "invalid_scope", description: "Requested scope is not allowed for this client"}
+	}
+
+	_, err := h.lookupResource(ctx, &client, req.Resource)
+	if errors.Is(err, errInvalidTarget) {
+		return nil, &authorizeError{redirect: true, code: "invalid_target", description: "Unknown resource or not allowed for this client"}
+	}
+	if err != nil {
+		return nil, &authorizeError{err: err, internalCode: 20007}
+	}
+
+	return &client, nil
+}
+
+// respondAuthorizeError redirects the error back to the client, or reports it directly when the redirect_uri is not trusted
+func (h *Handler) respondAuthorizeError(c *gin.Context, req *AuthorizeRequest, authErr *authorizeError) {
+	if authErr.internalCode != 0 {
+		h.RespondInternalError(c, authErr.err, authErr.internalCode)
+		return
+	}
+	if !authErr.redirect {
+		h.RespondError(c, http.StatusBadRequest, nil, authErr.description)
+		return
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Warn("Authorization Error", "error", authErr.code, "message", authErr.description, "client_id", req.ClientID, "trace_id", traceID)
+
+	params := map[string]string{
+		"error":             authErr.code,
+		"error_description": authErr.description,
+	}
+	if req.State != "" {
+		params["state"] = req.State
+	}
+	c.Redirect(http.StatusFound, buildRedirectURL(req.RedirectURI, params))
+}
+
+// buildRedirectURL adds the given query parameters to the redirect URI, keeping any existing ones
+func buildRedirectURL(redirectURI string, params map[string]string) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := u.Query()
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Authorize handles an OAuth 2.0 authorization code request. A user with an SSO session is signed in
+// silently unless the client asks for a new login; otherwise the login page is rendered.
+func (h *Handler) Authorize(c *gin.Context) {
+	var req AuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.RespondError(c, http.StatusBadRequest, err, "Invalid authorization request")
+		return
+	}
+
+	client, authErr := h.resolveAuthorizeRequest(c, &req)
+	if authErr != nil {
+		h.respondAuthorizeError(c, &req, authErr)
+		return
+	}
+
+	session, err := h.currentSession(c)
+	if err != nil {
+		h.RespondInternalError(c, err, 21001)
+		return
+	}
+	if session != nil && !req.requiresLogin(session) {
+		h.authorizeUser(c, client, &req, session)
+		return
+	}
+	if req.hasPrompt("none") {
+		h.respondAuthorizeError(c, &req, &authorizeError{redirect: true, code: "login_required", description: "The user must sign in"})
+		return
+	}
+
+	h.renderLogin(c, http.StatusOK, client, &req, "", "")
+}
+
+// renderLogin renders the login page for the authorization request, with the CSRF token for its form
+func (h *Handler) renderLogin(c *gin.Context, status int, client *models.Client, req *AuthorizeRequest, email, message string) {
+	csrfToken, err := h.csrfToken(c)
+	if err != nil {
+		h.RespondInternalError(c, err, 7003)
+		return
+	}
+
+	h.renderPage(c, status, "login", loginPage{
+		Title:      "Sign in",
+		Error:      message,
+		ClientName: client.Name,
+		Email:      email,
+		Hidden:     req.hiddenFields(),
+		CSRFToken:  csrfToken,
+	})
+}
+
+// AuthorizeLogin authenticates the user from the login page and continues the authorization
+func (h *Handler) AuthorizeLogin(c *gin.Context) {
+	var form AuthorizeLoginForm
+	if err := c.ShouldBind(&form); err != nil {
+		h.RespondError(c, http.StatusBadRequest, err, "Invalid authorization request")
+		return
+	}
+	req := &form.AuthorizeRequest
+
+	client, authErr := h.resolveAuthorizeRequest(c, req)
+	if authErr != nil {
+		h.respondAuthorizeError(c, req, authErr)
+		return
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	if !checkCSRFToken(c) {
+		slog.Warn("Client Error", "status", http.StatusForbidden, "message", "Invalid CSRF token", "trace_id", traceID)
+		h.renderLogin(c, http.StatusForbidden, client, req, form.Email, "Your sign-in form expired, please try again")
+		return
+	}
+
+	user, err := h.checkUserCredentials(form.Email, form.Password)
+	if err != nil {
+		slog.Warn("Client Error", "status", http.StatusUnauthorized, "message", "Invalid credentials", "error", err, "trace_id", traceID)
+		h.renderLogin(c, http.StatusUnauthorized, client, req, form.Email, "Invalid email or password")
+		return
+	}
+
+	session, err := h.startSession(c, user.ID.String(), []string{amrPassword})
+	if err != nil {
+		h.RespondInternalError(c, err, 21002)
+		return
+	}
+
+	h.authorizeUser(c, client, req, session)
+}
+
+// authorizeUser continues an authorization request once the user is authenticated:
+// it asks for consent when the requested scope is not yet covered, otherwise it issues the code.
+func (h *Handler) authorizeUser(c *gin.Context, client *models.Client, req *AuthorizeRequest, session *ssoSession) {
+	// A pushed request is single use: it is spent once the user is signed in
+	if req.RequestURI != "" {
+		if err := h.RedisClient.Del(c, pushedRequestKey(req.RequestURI)).Err(); err != nil {
+			h.RespondInternalError(c, err, 7004)
+			return
+		}
+	}
+
+	consented, err := h.hasConsent(c, session.UserID, client.ID.String(), req.Scope)
+	if err != nil {
+		h.RespondInternalError(c, err, 7002)
+		return
+	}
+	if !consented || req.hasPrompt("consent") {
+		if req.hasPrompt("none") {
+			h.respondAuthorizeError(c, req, &authorizeError{redirect: true, code: "consent_required", description: "The user must consent to the requested scope"})
+			return
+		}
+		h.promptConsent(c, client, &consentRequest{Request: *req, SessionID: session.ID, UserID: session.UserID})
+		return
+	}
+
+	h.completeAuthorization(c, client, req, session)
+}
+
+// completeAuthorization issues the authorization code and redirects back to the client
+func (h *Handler) completeAuthorization(c *gin.Context, client *models.Client, req *AuthorizeRequest, session *ssoSession) {
+	userID := session.UserID
+	code, ok := h.issueAuthCode(c, AuthCodeData{
+		ClientID:      client.ID.String(),
+		UserID:        userID,
+		CodeChallenge: req.CodeChallenge,
+		RedirectURI:   req.RedirectURI,
+		Nonce:         req.Nonce,
+		Scope:         req.Scope,
+		Resource:      req.Resource,
+		AuthTime:      session.AuthTime,
+		AMR:           session.AMR,
+	})
+	if !ok {
+		return
+	}
+
+	params := map[string]string{"code": code}
+	if req.State != "" {
+		params["state"] = req.State
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("User authorized", "user_id", userID, "client_id", client.ID, "trace_id", traceID)
+	c.Redirect(http.StatusFound, buildRedirectURL(req.RedirectURI, params))
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Back-channel logout notifications are queued in Redis, so they survive a restart of the server, and are
+// delivered by a background worker. The queue is scored by the time of the next attempt in milliseconds:
+// Key format: backchannel_logout_queue -> sorted set of JSON backchannelLogout
+
+const (
+	backchannelLogoutQueueKey = "backchannel_logout_queue"
+
+	// Notifications are retried with exponential backoff, starting at the base delay
+	backchannelLogoutAttempts  = 4
+	backchannelLogoutBaseDelay = time.Second
+	// A notification being delivered is hidden from other workers for the lease.
+	// If the server stops before the attempt is recorded, the notification is delivered again afterwards.
+	backchannelLogoutLease        = 2 * time.Minute
+	backchannelLogoutBatchSize    = 10
+	backchannelLogoutPollInterval = time.Second
+)
+
+var backchannelLogoutClient = utils.NewExternalHTTPClient(5 * time.Second)
+
+// claimBackchannelLogoutsScript returns the notifications due at ARGV[1], at most ARGV[3] of them,
+// and postpones them to the end of their lease at ARGV[2]
+var claimBackchannelLogoutsScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, member in ipairs(due) do
+	redis.call('ZADD', KEYS[1], ARGV[2], member)
+end
+return due
+`)
+
+// backchannelLogout is a queued notification. The logout token is only generated when it is sent,
+// so it cannot expire while the notification waits for a retry.
+type backchannelLogout struct {
+	ID       string `json:"id"` // Keeps identical notifications apart in the queue
+	ClientID string `json:"client_id"`
+	Subject  string `json:"sub"`
+	Attempt  int    `json:"attempt"`
+	TraceID  any    `json:"trace_id,omitempty"`
+}
+
+// queueBackchannelLogouts queues a notification for each client in subjects, which maps the client ID
+// to the sub the client knows the signed out user by
+func (h *Handler) queueBackchannelLogouts(ctx context.Context, subjects map[string]string, traceID any) error {
+	if len(subjects) == 0 {
+		return nil
+	}
+
+	now := float64(time.Now().UnixMilli())
+	members := make([]redis.Z, 0, len(subjects))
+	for clientID, subject := range subjects {
+		jsonData, err := json.Marshal(backchannelLogout{ID: uuid.New().String(), ClientID: clientID, Subject: subject, Attempt: 1, TraceID: traceID})
+		if err != nil {
+			return err
+		}
+		members = append(members, redis.Z{Score: now, Member: jsonData})
+	}
+	return h.RedisClient.ZAdd(ctx, backchannelLogoutQueueKey, members...).Err()
+}
+
+// RunBackchannelLogoutWorker delivers queued back-channel logout notifications until the context is done.
+// Every server instance can run one, as each notification is leased to a single worker at a time.
+func (h *Handler) RunBackchannelLogoutWorker(ctx context.Context) {
+	ticker := time.NewTicker(backchannelLogoutPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := h.deliverDueLogouts(ctx); err != nil {
+			slog.Error("Back-channel logout queue failed", "error", err)
+		}
+	}
+}
+
+// deliverDueLogouts claims the notifications that are due and sends them, rescheduling the ones that failed
+func (h *Handler) deliverDueLogouts(ctx context.Context) error {
+	now := time.Now()
+	members, err := claimBackchannelLogoutsScript.Run(ctx, h.RedisClient, []string{backchannelLogoutQueueKey},
+		now.UnixMilli(), now.Add(backchannelLogoutLease).UnixMilli(), backchannelLogoutBatchSize).StringSlice()
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		var logout backchannelLogout
+		if err := json.Unmarshal([]byte(member), &logout); err != nil {
+			slog.Error("Back-channel logout dropped", "error", err)
+			if err := h.RedisClient.ZRem(ctx, backchannelLogoutQueueKey, member).Err(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		sendErr := h.sendLogoutToken(ctx, &logout)
+		if err := h.recordLogoutAttempt(ctx, member, &logout, sendErr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordLogoutAttempt removes the notification from the queue, scheduling the next attempt when sending failed
+func (h *Handler) recordLogoutAttempt(ctx context.Context, member string, logout *backchannelLogout, sendErr error) error {
+	pipe := h.RedisClient.TxPipeline()
+	pipe.ZRem(ctx, backchannelLogoutQueueKey, member)
+
+	switch {
+	case sendErr == nil:
+		slog.Info("Back-channel logout delivered", "client_id", logout.ClientID, "attempt", logout.Attempt, "trace_id", logout.TraceID)
+	case logout.Attempt < backchannelLogoutAttempts:
+		slog.Warn("Back-channel logout failed", "client_id", logout.ClientID, "attempt", logout.Attempt, "error", sendErr, "trace_id", logout.TraceID)
+		delay := backchannelLogoutBaseDelay << (logout.Attempt - 1)
+		logout.Attempt++
+		jsonData, err := json.Marshal(logout)
+		if err != nil {
+			return err
+		}
+		pipe.ZAdd(ctx, backchannelLogoutQueueKey, redis.Z{Score: float64(time.Now().Add(delay).UnixMilli()), Member: jsonData})
+	default:
+		slog.Error("Back-channel logout abandoned", "client_id", logout.ClientID, "attempt", logout.Attempt, "error", sendErr, "trace_id", logout.TraceID)
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// sendLogoutToken POSTs a fresh logout token to the client's back-channel logout URI.
+// The client acknowledges it with a 2xx response. Clients that were deleted or no longer
+// want notifications are skipped.
+func (h *Handler) sendLogoutToken(ctx context.Context, logout *backchannelLogout) error {
+	var client models.Client
+	err := h.DB.WithContext(ctx).Where("id = ?", logout.ClientID).First(&client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if client.BackchannelLogoutURI == "" {
+		return nil
+	}
+	// Whatever was registered, the server never calls into its own network
+	if err := utils.ValidateExternalURL(client.BackchannelLogoutURI); err != nil {
+		return err
+	}
+
+	logoutToken, err := utils.GenerateLogoutToken(client.PrivateKey, utils.LogoutTokenClaims{
+		Issuer:   h.Config.Issuer,
+		Subject:  logout.Subject,
+		Audience: client.ID.String(),
+	}, logoutTokenExpMinutes)
+	if err != nil {
+		return err
+	}
+
+	body := url.Values{"logout_token": {logoutToken}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, client.BackchannelLogoutURI, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := backchannelLogoutClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
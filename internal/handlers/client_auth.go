@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Client authentication methods of RFC 7591 Section 2, configured per client
+const (
+	authMethodSecretBasic   = "client_secret_basic"
+	authMethodSecretPost    = "client_secret_post"
+	authMethodPrivateKeyJWT = "private_key_jwt"
+
+	// Mutual-TLS methods of RFC 8705 Section 2
+	authMethodTLSClientAuth           = "tls_client_auth"
+	authMethodSelfSignedTLSClientAuth = "self_signed_tls_client_auth"
+)
+
+var tokenEndpointAuthMethods = []string{
+	authMethodSecretBasic, authMethodSecretPost, authMethodPrivateKeyJWT,
+	authMethodTLSClientAuth, authMethodSelfSignedTLSClientAuth,
+}
+
+const (
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	// Assertions living longer than this are rejected, which also bounds how long their jti is remembered
+	maxClientAssertionLifetime = time.Hour
+)
+
+// clientAuthError is a failed client authentication. Its message is safe to return to the client.
+// Internal errors carry their unique error code instead.
+type clientAuthError struct {
+	message      string
+	err          error
+	internalCode int
+}
+
+func (e *clientAuthError) Error() string { return e.message }
+
+func (e *clientAuthError) Unwrap() error { return e.err }
+
+// clientFromRequest authenticates the client with the method it registered: HTTP Basic,
+// client_id and client_secret body parameters, a signed JWT assertion (RFC 7523),
+// or the certificate of a mutual-TLS connection together with the client_id parameter (RFC 8705)
+func (h *Handler) clientFromRequest(c *gin.Context) (*models.Client, *clientAuthError) {
+	basicID, basicSecret, hasBasic := c.Request.BasicAuth()
+	postSecret := c.PostForm("client_secret")
+	assertionType := c.PostForm("client_assertion_type")
+
+	// RFC 6749 Section 2.3: a client must not use more than one authentication method per request
+	used := 0
+	for _, present := range []bool{hasBasic, postSecret != "", assertionType != ""} {
+		if present {
+			used++
+		}
+	}
+	if used > 1 {
+		return nil, &clientAuthError{message: "Multiple client authentication methods used"}
+	}
+
+	var (
+		client  *models.Client
+		method  string
+		authErr *clientAuthError
+	)
+	switch {
+	case hasBasic:
+		method = authMethodSecretBasic
+		client, authErr = h.clientFromSecret(basicID, basicSecret)
+	case postSecret != "":
+		method = authMethodSecretPost
+		client, authErr = h.clientFromSecret(c.PostForm("client_id"), postSecret)
+	case assertionType != "":
+		method = authMethodPrivateKeyJWT
+		client, authErr = h.clientFromAssertion(c, assertionType, c.PostForm("client_assertion"))
+	case len(peerCertificates(c)) > 0 && c.PostForm("client_id") != "":
+		client, method, authErr = h.clientFromCertificate(c.PostForm("client_id"), peerCertificates(c))
+	default:
+		return nil, &clientAuthError{message: "Client authentication required"}
+	}
+	if authErr != nil {
+		return nil, authErr
+	}
+
+	if client.TokenEndpointAuthMethod != method {
+		return nil, &clientAuthError{message: "Client is not allowed to authenticate with " + method}
+	}
+	if clientID := c.PostForm("client_id"); clientID != "" && clientID != client.ID.String() {
+		return nil, &clientAuthError{message: "client_id does not match the authenticated client"}
+	}
+
+	return client, nil
+}
+
+// clientFromSecret looks up the client and compares its hashed secret
+func (h *Handler) clientFromSecret(clientID, clientSecret string) (*models.Client, *clientAuthError) {
+	var client models.Client
+	if err := h.DB.Where("id = ?", clientID).First(&client).Error; err != nil {
+		return nil, &clientAuthError{message: "Invalid Client", err: err}
+	}
+
+	// Compare Hash
+	if !utils.CheckPassword(clientSecret, client.Secret) {
+		return nil, &clientAuthError{message: "Invalid Client Secret"}
+	}
+
+	return &client, nil
+}
+
+// clientFromAssertion authenticates the client with a JWT signed by a key of its registered JWKS.
+// Every assertion is single use: its jti is remembered in Redis until it expires.
+func (h *Handler) clientFromAssertion(c *gin.Context, assertionType, assertion string) (*models.Client, *clientAuthError) {
+	if assertionType != clientAssertionType {
+		return nil, &clientAuthError{message: "Unsupported client_assertion_type"}
+	}
+	if assertion == "" {
+		return nil, &clientAuthError{message: "client_assertion is required"}
+	}
+
+	// 1. The issuer identifies the client whose keys verify the assertion
+	token, _, err := new(jwt.Parser).ParseUnverified(assertion, jwt.MapClaims{})
+	if err != nil {
+		return nil, &clientAuthError{message: "Invalid client assertion", err: err}
+	}
+	clientID, _ := token.Claims.(jwt.MapClaims)["iss"].(string)
+
+	var client models.Client
+	if err := h.DB.Where("id = ?", clientID).First(&client).Error; err != nil {
+		return nil, &clientAuthError{message: "Invalid Client", err: err}
+	}
+	if client.JWKS == "" {
+		return nil, &clientAuthError{message: "Client has no registered JWKS"}
+	}
+	jwks, err := utils.ParseJWKS([]byte(client.JWKS))
+	if err != nil {
+		return nil, &clientAuthError{message: "Client has no usable JWKS", err: err}
+	}
+
+	// 2. Verify Signature and Claims (RFC 7523 Section 3)
+	claims, err := utils.ValidateClientAssertion(assertion, jwks)
+	if err != nil {
+		return nil, &clientAuthError{message: "Invalid client assertion", err: err}
+	}
+	if sub, _ := claims["sub"].(string); sub != clientID {
+		return nil, &clientAuthError{message: "Client assertion sub must be the client_id"}
+	}
+	if !h.validAssertionAudience(c, claims) {
+		return nil, &clientAuthError{message: "Client assertion audience is not this server"}
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, &clientAuthError{message: "Client assertion jti is required"}
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, &clientAuthError{message: "Invalid client assertion", err: err}
+	}
+	lifetime := time.Until(exp.Time)
+	if lifetime > maxClientAssertionLifetime {
+		return nil, &clientAuthError{message: "Client assertion expires too far in the future"}
+	}
+
+	// 3. Prevent Replay
+	// Key format: client_assertion_jti:{client_id}:{jti}
+	fresh, err := h.RedisClient.SetNX(c, "client_assertion_jti:"+clientID+":"+jti, "used", lifetime).Result()
+	if err != nil {
+		return nil, &clientAuthError{err: err, internalCode: 3011}
+	}
+	if !fresh {
+		return nil, &clientAuthError{message: "Client assertion has already been used"}
+	}
+
+	return &client, nil
+}
+
+// validAssertionAudience accepts assertions addressed to the issuer or to the endpoint receiving them
+func (h *Handler) validAssertionAudience(c *gin.Context, claims jwt.MapClaims) bool {
+	audiences, err := claims.GetAudience()
+	if err != nil {
+		return false
+	}
+	for _, aud := range audiences {
+		if aud == h.Config.Issuer || aud == h.endpointURL("/oauth/token") || aud == h.requestURL(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateClient authenticates the client of an OAuth endpoint with its registered method.
+// On failure it responds with Unauthorized and returns false.
+func (h *Handler) authenticateClient(c *gin.Context) (*models.Client, bool) {
+	client, authErr := h.clientFromRequest(c)
+	if authErr != nil {
+		h.respondClientAuthError(c, authErr)
+		return nil, false
+	}
+	return client, true
+}
+
+// authenticateClientSecret authenticates the client with HTTP Basic and its secret, whatever its
+// token endpoint auth method. The client's own management endpoints use it.
+func (h *Handler) authenticateClientSecret(c *gin.Context) (*models.Client, bool) {
+	clientID, clientSecret, ok := c.Request.BasicAuth()
+	if !ok {
+		h.RespondError(c, http.StatusUnauthorized, nil, "Basic auth required")
+		return nil, false
+	}
+
+	client, authErr := h.clientFromSecret(clientID, clientSecret)
+	if authErr != nil {
+		h.respondClientAuthError(c, authErr)
+		return nil, false
+	}
+	return client, true
+}
+
+func (h *Handler) respondClientAuthError(c *gin.Context, authErr *clientAuthError) {
+	if authErr.internalCode != 0 {
+		h.RespondInternalError(c, authErr.err, authErr.internalCode)
+		return
+	}
+	h.RespondError(c, http.StatusUnauthorized, authErr.err, authErr.message)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"auth-system/internal/middleware"
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ClientPolicyRequest holds the client settings that grant access rather than describe the client.
+// Clients cannot change them themselves; only the server administrator can. The same goes for the
+// redirect URIs of pairwise clients.
+type ClientPolicyRequest struct {
+	Scope                  *string   `json:"scope"`
+	TokenExchangeAudiences *[]string `json:"token_exchange_audiences"`
+	AllowedResources       *[]string `json:"allowed_resources"`
+	RedirectURIs           *[]string `json:"redirect_uris"`
+}
+
+// UpdateClientPolicy changes what a client is allowed to request.
+// Like client registration it requires the initial access token configured on the server.
+func (h *Handler) UpdateClientPolicy(c *gin.Context) {
+	if !h.authenticateInitialAccessToken(c) {
+		return
+	}
+
+	clientID, err := uuid.Parse(c.Param("client_id"))
+	if err != nil {
+		h.RespondError(c, http.StatusNotFound, err, "Client not found")
+		return
+	}
+	var client models.Client
+	if err := h.DB.Where("id = ?", clientID).First(&client).Error; err != nil {
+		h.RespondError(c, http.StatusNotFound, err, "Client not found")
+		return
+	}
+
+	var req ClientPolicyRequest
+	validationErrors, err := h.GetValidationErrors(c, &req)
+	if err != nil {
+		h.RespondError(c, http.StatusBadRequest, err, "Invalid JSON")
+		return
+	}
+	if validationErrors == nil {
+		validationErrors = make(map[string]any)
+	}
+
+	if req.Scope != nil {
+		if err := utils.ValidateScope(*req.Scope); err != nil {
+			MergeErrors(validationErrors, map[string]any{"scope": err.Error()})
+		}
+	}
+	if req.TokenExchangeAudiences != nil {
+		audienceErrors, err := h.validateTokenExchangeAudiences(*req.TokenExchangeAudiences)
+		if err != nil {
+			h.RespondInternalError(c, err, 12012)
+			return
+		}
+		MergeErrors(validationErrors, audienceErrors)
+	}
+	if req.AllowedResources != nil {
+		resourceErrors, err := h.validateAllowedResources(*req.AllowedResources)
+		if err != nil {
+			h.RespondInternalError(c, err, 12013)
+			return
+		}
+		MergeErrors(validationErrors, resourceErrors)
+	}
+	if req.RedirectURIs != nil {
+		MergeErrors(validationErrors, validateRedirectURIs(*req.RedirectURIs))
+	}
+
+	if len(validationErrors) > 0 {
+		h.RespondValidationError(c, validationErrors)
+		return
+	}
+
+	if req.Scope != nil {
+		client.Scopes = *req.Scope
+	}
+	if req.TokenExchangeAudiences != nil {
+		client.TokenExchangeAudiences = *req.TokenExchangeAudiences
+	}
+	if req.AllowedResources != nil {
+		client.AllowedResources = *req.AllowedResources
+	}
+	if req.RedirectURIs != nil {
+		client.RedirectURIs = *req.RedirectURIs
+	}
+
+	if err := h.DB.Save(&client).Error; err != nil {
+		h.RespondInternalError(c, err, 12009)
+		return
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("Client policy updated", "client_id", client.ID, "trace_id", traceID)
+	c.JSON(http.StatusOK, clientDetails(&client))
+}
@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"auth-system/internal/middleware"
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ClientMetadata is the client metadata of RFC 7591 Section 2
+type ClientMetadata struct {
+	ClientID                string          `json:"client_id"` // Only sent when updating a registration
+	ClientName              string          `json:"client_name"`
+	RedirectURIs            []string        `json:"redirect_uris"`
+	GrantTypes              []string        `json:"grant_types"`
+	ResponseTypes           []string        `json:"response_types"`
+	TokenEndpointAuthMethod string          `json:"token_endpoint_auth_method"`
+	Scope                   string          `json:"scope"`
+	JWKS                    json.RawMessage `json:"jwks"`
+	RequirePAR              bool            `json:"require_pushed_authorization_requests"`
+	TLSSubjectDN            string          `json:"tls_client_auth_subject_dn"`
+	CertificateBoundTokens  bool            `json:"tls_client_certificate_bound_access_tokens"`
+	TokenExchangeAudiences  []string        `json:"token_exchange_audiences"`
+	PostLogoutRedirectURIs  []string        `json:"post_logout_redirect_uris"`
+	BackchannelLogoutURI    string          `json:"backchannel_logout_uri"`
+	RequestURIs             []string        `json:"request_uris"`
+	RequireSignedRequest    bool            `json:"require_signed_request_object"`
+	AllowedResources        []string        `json:"allowed_resources"`
+	SubjectType             string          `json:"subject_type"`
+}
+
+// RegisterDynamicClient implements RFC 7591 dynamic client registration.
+// Registration requires the initial access token configured on the server.
+func (h *Handler) RegisterDynamicClient(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	// 1. Check Initial Access Token
+	if !h.authenticateInitialAccessToken(c) {
+		return
+	}
+
+	// 2. Read and Validate Metadata
+	var meta ClientMetadata
+	if err := c.ShouldBindJSON(&meta); err != nil {
+		h.RespondOAuthError(c, http.StatusBadRequest, err, "invalid_client_metadata", "Invalid JSON")
+		return
+	}
+	code, description, err := h.validateClientMetadata(&meta, uuid.Nil)
+	if err != nil {
+		h.RespondInternalError(c, err, 12010)
+		return
+	}
+	if code != "" {
+		h.RespondOAuthError(c, http.StatusBadRequest, nil, code, description)
+		return
+	}
+
+	// 3. Generate Credentials
+	secret, err := utils.GenerateRandomString(32)
+	if err != nil {
+		h.RespondInternalError(c, err, 12001)
+		return
+	}
+	hashedSecret, err := utils.HashPassword(secret)
+	if err != nil {
+		h.RespondInternalError(c, err, 12002)
+		return
+	}
+	privKey, pubKey, err := utils.GenerateRSAKeyPair()
+	if err != nil {
+		h.RespondInternalError(c, err, 12003)
+		return
+	}
+	registrationToken, err := utils.GenerateRandomString(32)
+	if err != nil {
+		h.RespondInternalError(c, err, 12004)
+		return
+	}
+	hashedRegistrationToken, err := utils.HashPassword(registrationToken)
+	if err != nil {
+		h.RespondInternalError(c, err, 12005)
+		return
+	}
+
+	client := models.Client{
+		ID:                      uuid.New(),
+		Secret:                  hashedSecret,
+		PrivateKey:              privKey,
+		PublicKey:               pubKey,
+		RegistrationAccessToken: hashedRegistrationToken,
+	}
+	applyClientMetadata(&client, &meta)
+
+	// 4. Save Client
+	if err := h.DB.Create(&client).Error; err != nil {
+		h.RespondInternalError(c, err, 12006)
+		return
+	}
+
+	response := h.registrationResponse(&client)
+	response["registration_access_token"] = registrationToken
+	// Clients authenticating with a key pair have no use for the secret
+	if client.TokenEndpointAuthMethod != authMethodPrivateKeyJWT {
+		response["client_secret"] = secret // Return PLAIN secret once
+		response["client_secret_expires_at"] = 0
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("Client registered dynamically", "client_id", client.ID, "client_name", client.Name, "trace_id", traceID)
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetClientRegistration implements the RFC 7592 read request
+func (h *Handler) GetClientRegistration(c *gin.Context) {
+	client, ok := h.authenticateRegistration(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, h.registrationResponse(client))
+}
+
+// UpdateClientRegistration implements the RFC 7592 update request. The metadata replaces the
+// registered metadata entirely: omitted fields fall back to their defaults.
+func (h *Handler) UpdateClientRegistration(c *gin.Context) {
+	client, ok := h.authenticateRegistration(c)
+	if !ok {
+		return
+	}
+
+	var meta ClientMetadata
+	if err := c.ShouldBindJSON(&meta); err != nil {
+		h.RespondOAuthError(c, http.StatusBadRequest, err, "invalid_client_metadata", "Invalid JSON")
+		return
+	}
+	if meta.ClientID != client.ID.String() {
+		h.RespondOAuthError(c, http.StatusBadRequest, nil, "invalid_client_metadata", "client_id must match the registration")
+		return
+	}
+	// What the client may request is granted by the server administrator, the client cannot change it
+	meta.Scope = client.Scopes
+	meta.TokenExchangeAudiences = client.TokenExchangeAudiences
+	meta.AllowedResources = client.AllowedResources
+	code, description, err := h.validateClientMetadata(&meta, client.ID)
+	if err != nil {
+		h.RespondInternalError(c, err, 12011)
+		return
+	}
+	if code != "" {
+		h.RespondOAuthError(c, http.StatusBadRequest, nil, code, description)
+		return
+	}
+	for field, message := range validateSubjectChange(client, meta.SubjectType, meta.RedirectURIs) {
+		h.RespondOAuthError(c, http.StatusBadRequest, nil, "invalid_client_metadata", field+": "+message.(string))
+		return
+	}
+
+	applyClientMetadata(client, &meta)
+	if err := h.DB.Save(client).Error; err != nil {
+		h.RespondInternalError(c, err, 12007)
+		return
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("Client registration updated", "client_id", client.ID, "trace_id", traceID)
+	c.JSON(http.StatusOK, h.registrationResponse(client))
+}
+
+// DeleteClientRegistration implements the RFC 7592 delete request
+func (h *Handler) DeleteClientRegistration(c *gin.Context) {
+	client, ok := h.authenticateRegistration(c)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Delete(client).Error; err != nil {
+		h.RespondInternalError(c, err, 12008)
+		return
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("Client registration deleted", "client_id", client.ID, "trace_id", traceID)
+	c.Status(http.StatusNoContent)
+}
+
+// authenticateRegistration checks the registration access token of a client configuration request.
+// Unknown clients and invalid tokens are not told apart.
+func (h *Handler) authenticateRegistration(c *gin.Context) (*models.Client, bool) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	fail := func(err error) (*models.Client, bool) {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		h.RespondOAuthError(c, http.StatusUnauthorized, err, "invalid_token", "Invalid registration access token")
+		return nil, false
+	}
+
+	token, ok := bearerToken(c)
+	if !ok {
+		return fail(nil)
+	}
+	clientID, err := uuid.Parse(c.Param("client_id"))
+	if err != nil {
+		return fail(err)
+	}
+
+	var client models.Client
+	if err := h.DB.Where("id = ?", clientID).First(&client).Error; err != nil {
+		return fail(err)
+	}
+	if client.RegistrationAccessToken == "" || !utils.CheckPassword(token, client.RegistrationAccessToken) {
+		return fail(nil)
+	}
+
+	return &client, true
+}
+
+// authenticateInitialAccessToken checks the Bearer token against the initial access token configured on the server.
+// On failure it responds with Unauthorized and returns false.
+func (h *Handler) authenticateInitialAccessToken(c *gin.Context) bool {
+	token, ok := bearerToken(c)
+	if !ok || h.Config.RegistrationInitialAccessToken == "" ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(h.Config.RegistrationInitialAccessToken)) != 1 {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		h.RespondOAuthError(c, http.StatusUnauthorized, nil, "invalid_token", "A valid initial access token is required")
+		return false
+	}
+	return true
+}
+
+// validateClientMetadata fills in the RFC 7591 defaults and returns the error code and description
+// of the first invalid field, or an empty code. excludeID is the client being updated, if any.
+func (h *Handler) validateClientMetadata(meta *ClientMetadata, excludeID uuid.UUID) (string, string, error) {
+	if len(meta.GrantTypes) == 0 {
+		meta.GrantTypes = []string{"authorization_code"}
+	}
+	if meta.TokenEndpointAuthMethod == "" {
+		meta.TokenEndpointAuthMethod = authMethodSecretBasic
+	}
+	if meta.Scope == "" {
+		meta.Scope = defaultClientScopes
+	}
+	if meta.SubjectType == "" {
+		meta.SubjectType = subjectTypePublic
+	}
+
+	for _, grantType := range meta.GrantTypes {
+		if !slices.Contains(supportedGrantTypes, grantType) {
+			return "invalid_client_metadata", "Unsupported grant type " + grantType, nil
+		}
+	}
+	for _, responseType := range meta.ResponseTypes {
+		if responseType != "code" {
+			return "invalid_client_metadata", "Unsupported response type " + responseType, nil
+		}
+	}
+	if !slices.Contains(tokenEndpointAuthMethods, meta.TokenEndpointAuthMethod) {
+		return "invalid_client_metadata", "Unsupported token_endpoint_auth_method " + meta.TokenEndpointAuthMethod, nil
+	}
+
+	if slices.Contains(meta.GrantTypes, "authorization_code") && len(meta.RedirectURIs) == 0 {
+		return "invalid_redirect_uri", "redirect_uris are required for the authorization_code grant", nil
+	}
+	for _, uri := range meta.RedirectURIs {
+		if err := utils.ValidateRedirectURI(uri); err != nil {
+			return "invalid_redirect_uri", uri + ": " + err.Error(), nil
+		}
+	}
+
+	if err := utils.ValidateScope(meta.Scope); err != nil {
+		return "invalid_client_metadata", err.Error(), nil
+	}
+	for field, message := range validateClientAuthentication(meta.TokenEndpointAuthMethod, jwksParam(meta.JWKS), meta.TLSSubjectDN) {
+		return "invalid_client_metadata", field + ": " + message.(string), nil
+	}
+	audienceErrors, err := h.validateTokenExchangeAudiences(meta.TokenExchangeAudiences)
+	if err != nil {
+		return "", "", err
+	}
+	for field, message := range audienceErrors {
+		return "invalid_client_metadata", field + ": " + message.(string), nil
+	}
+	resourceErrors, err := h.validateAllowedResources(meta.AllowedResources)
+	if err != nil {
+		return "", "", err
+	}
+	for field, message := range resourceErrors {
+		return "invalid_client_metadata", field + ": " + message.(string), nil
+	}
+	for field, message := range h.validateSubjectType(meta.SubjectType) {
+		return "invalid_client_metadata", field + ": " + message.(string), nil
+	}
+	for _, uri := range meta.PostLogoutRedirectURIs {
+		if err := utils.ValidateRedirectURI(uri); err != nil {
+			return "invalid_client_metadata", "post_logout_redirect_uris: " + uri + ": " + err.Error(), nil
+		}
+	}
+	for field, message := range validateLogoutURIs(nil, meta.BackchannelLogoutURI) {
+		return "invalid_client_metadata", field + ": " + message.(string), nil
+	}
+	for field, message := range validateRequestObjectSettings(meta.RequestURIs, meta.RequireSignedRequest, jwksParam(meta.JWKS)) {
+		return "invalid_client_metadata", field + ": " + message.(string), nil
+	}
+
+	if meta.ClientName != "" {
+		var count int64
+		if err := h.DB.Model(&models.Client{}).Where("name = ? AND id <> ?", meta.ClientName, excludeID).Count(&count).Error; err != nil {
+			return "", "", err
+		}
+		if count > 0 {
+			return "invalid_client_metadata", "Client name already registered", nil
+		}
+	}
+
+	return "", "", nil
+}
+
+// applyClientMetadata copies validated metadata onto the client. Unnamed clients are named after their ID.
+func applyClientMetadata(client *models.Client, meta *ClientMetadata) {
+	client.Name = meta.ClientName
+	if client.Name == "" {
+		client.Name = client.ID.String()
+	}
+	client.RedirectURIs = meta.RedirectURIs
+	client.GrantTypes = meta.GrantTypes
+	client.TokenEndpointAuthMethod = meta.TokenEndpointAuthMethod
+	client.Scopes = meta.Scope
+	client.JWKS = jwksParam(meta.JWKS)
+	client.RequirePushedAuthorizationRequests = meta.RequirePAR
+	client.TLSClientAuthSubjectDN = meta.TLSSubjectDN
+	client.TLSClientCertificateBoundAccessTokens = meta.CertificateBoundTokens
+	client.TokenExchangeAudiences = meta.TokenExchangeAudiences
+	client.PostLogoutRedirectURIs = meta.PostLogoutRedirectURIs
+	client.BackchannelLogoutURI = meta.BackchannelLogoutURI
+	client.RequestURIs = meta.RequestURIs
+	client.RequireSignedRequestObject = meta.RequireSignedRequest
+	client.AllowedResources = meta.AllowedResources
+	client.SubjectType = meta.SubjectType
+}
+
+// registrationResponse is the client information response of RFC 7591 Section 3.2.1
+func (h *Handler) registrationResponse(client *models.Client) gin.H {
+	responseTypes := []string{}
+	if client.AllowsGrantType("authorization_code") {
+		responseTypes = append(responseTypes, "code")
+	}
+
+	response := gin.H{
+		"client_id":                  client.ID.String(),
+		"client_id_issued_at":        client.CreatedAt.Unix(),
+		"client_name":                client.Name,
+		"redirect_uris":              client.RedirectURIs,
+		"grant_types":                client.GrantTypes,
+		"response_types":             responseTypes,
+		"token_endpoint_auth_method": client.TokenEndpointAuthMethod,
+		"scope":                      client.Scopes,
+		"subject_type":               client.SubjectType,
+		"registration_client_uri":    h.endpointURL("/oauth/register/" + client.ID.String()),
+
+		"require_pushed_authorization_requests":      client.RequirePushedAuthorizationRequests,
+		"require_signed_request_object":              client.RequireSignedRequestObject,
+		"tls_client_certificate_bound_access_tokens": client.TLSClientCertificateBoundAccessTokens,
+	}
+	if len(client.RequestURIs) > 0 {
+		response["request_uris"] = client.RequestURIs
+	}
+	if len(client.PostLogoutRedirectURIs) > 0 {
+		response["post_logout_redirect_uris"] = client.PostLogoutRedirectURIs
+	}
+	if client.BackchannelLogoutURI != "" {
+		response["backchannel_logout_uri"] = client.BackchannelLogoutURI
+	}
+	if len(client.TokenExchangeAudiences) > 0 {
+		response["token_exchange_audiences"] = client.TokenExchangeAudiences
+	}
+	if len(client.AllowedResources) > 0 {
+		response["allowed_resources"] = client.AllowedResources
+	}
+	if client.TLSClientAuthSubjectDN != "" {
+		response["tls_client_auth_subject_dn"] = client.TLSClientAuthSubjectDN
+	}
+	if jwks := clientJWKS(client); jwks != nil {
+		response["jwks"] = jwks
+	}
+	return response
+}
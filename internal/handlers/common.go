@@ -4,6 +4,7 @@ import (
 	"auth-system/internal/config"
 	"auth-system/internal/database"
 	"auth-system/internal/middleware"
+	"crypto/x509"
 	"errors"
 	"log/slog"
 	"net/http"
@@ -21,6 +22,7 @@ type Handler struct {
 	DB          *gorm.DB
 	RedisClient *redis.Client
 	Config      *config.Config
+	ClientCAs   *x509.CertPool // CAs trusted for tls_client_auth, nil when mutual TLS is not configured
 }
 
 func NewHandler(cfg *config.Config) *Handler {
@@ -53,6 +55,31 @@ func (h *Handler) RespondError(c *gin.Context, status int, err error, message st
 	})
 }
 
+// OAuthErrorResponse is the error response of RFC 6749 Section 5.2, used by the token endpoint
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// RespondOAuthError writes an RFC 6749 error response. These responses must never be cached.
+func (h *Handler) RespondOAuthError(c *gin.Context, status int, err error, code, description string) {
+	traceID, _ := c.Get(middleware.TraceIDKey)
+
+	slog.Warn("OAuth Error",
+		"status", status,
+		"error_code", code,
+		"description", description,
+		"error", err,
+		"trace_id", traceID,
+	)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(status, OAuthErrorResponse{
+		Error:            code,
+		ErrorDescription: description,
+	})
+}
+
 func (h *Handler) RespondValidationError(c *gin.Context, fields map[string]any) {
 	traceID, _ := c.Get(middleware.TraceIDKey)
 	
@@ -110,16 +137,27 @@ func msgForValidationTag(fe validator.FieldError) string {
 
 // GetValidationErrors binds the JSON and returns validation errors or fatal error.
 func (h *Handler) GetValidationErrors(c *gin.Context, obj any) (map[string]any, error) {
-	if err := c.ShouldBindJSON(obj); err != nil {
+	return bindingValidationErrors(c.ShouldBindJSON(obj), obj)
+}
+
+// GetFormValidationErrors binds the request according to its Content-Type (form or JSON) and returns validation errors or fatal error.
+func (h *Handler) GetFormValidationErrors(c *gin.Context, obj any) (map[string]any, error) {
+	return bindingValidationErrors(c.ShouldBind(obj), obj)
+}
+
+func bindingValidationErrors(err error, obj any) (map[string]any, error) {
+	if err != nil {
 		var ve validator.ValidationErrors
 		if errors.As(err, &ve) {
 			out := make(map[string]any)
 			for _, fe := range ve {
 				fieldName := fe.Field()
-				// Use reflection to get the JSON tag from the struct
+				// Use reflection to get the JSON (or form) tag from the struct
 				if field, ok := reflect.TypeOf(obj).Elem().FieldByName(fe.StructField()); ok {
 					if tag := field.Tag.Get("json"); tag != "" {
 						fieldName = strings.Split(tag, ",")[0]
+					} else if tag := field.Tag.Get("form"); tag != "" {
+						fieldName = strings.Split(tag, ",")[0]
 					}
 				}
 				out[fieldName] = msgForValidationTag(fe)
@@ -149,6 +187,21 @@ func (h *Handler) BindJSONWithValidation(c *gin.Context, obj any) bool {
 	return false
 }
 
+// BindFormWithValidation is BindJSONWithValidation for endpoints that also accept
+// application/x-www-form-urlencoded bodies, as most OAuth endpoints must.
+func (h *Handler) BindFormWithValidation(c *gin.Context, obj any) bool {
+	validationErrors, err := h.GetFormValidationErrors(c, obj)
+	if err != nil {
+		h.RespondError(c, http.StatusBadRequest, err, "Invalid request body")
+		return true
+	}
+	if len(validationErrors) > 0 {
+		h.RespondValidationError(c, validationErrors)
+		return true
+	}
+	return false
+}
+
 func MergeErrors(dest, src map[string]any) {
 	for k, v := range src {
 		if existing, ok := dest[k]; ok {
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"auth-system/internal/middleware"
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	consentRequestExpiry = 10 * time.Minute
+
+	// consentsScope lets a client manage the consents of the user it holds an access token for
+	consentsScope = "consents"
+)
+
+// consentRequest is an authenticated authorization request waiting for the user's consent.
+// It can only be answered from the SSO session it was started in.
+type consentRequest struct {
+	Request   AuthorizeRequest `json:"request"`
+	SessionID string           `json:"session_id"`
+	UserID    string           `json:"user_id"`
+}
+
+type ConsentForm struct {
+	ConsentRequest string `form:"consent_request"`
+	Action         string `form:"action"`
+}
+
+type consentPage struct {
+	Title          string
+	Error          string
+	ClientName     string
+	Scopes         []string
+	Action         string
+	ConsentRequest string
+	CSRFToken      string
+}
+
+// hasConsent reports whether the user already consented to every requested scope for the client
+func (h *Handler) hasConsent(ctx context.Context, userID, clientID, scope string) (bool, error) {
+	var consent models.Consent
+	err := h.DB.WithContext(ctx).Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return utils.ScopeSubset(scope, consent.Scopes), nil
+}
+
+// grantConsent records the user's consent, adding the scopes to any earlier consent for the client
+func (h *Handler) grantConsent(ctx context.Context, userID, clientID, scope string) error {
+	var consent models.Consent
+	err := h.DB.WithContext(ctx).Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		userUUID, err := uuid.Parse(userID)
+		if err != nil {
+			return err
+		}
+		clientUUID, err := uuid.Parse(clientID)
+		if err != nil {
+			return err
+		}
+		return h.DB.WithContext(ctx).Create(&models.Consent{
+			UserID:    userUUID,
+			ClientID:  clientUUID,
+			Scopes:    scope,
+			GrantedAt: time.Now(),
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	consent.Scopes = utils.MergeScopes(consent.Scopes, scope)
+	consent.GrantedAt = time.Now()
+	return h.DB.WithContext(ctx).Save(&consent).Error
+}
+
+// promptConsent parks the authorization request in Redis and renders the consent page
+func (h *Handler) promptConsent(c *gin.Context, client *models.Client, pending *consentRequest) {
+	id, err := utils.GenerateRandomString(32)
+	if err != nil {
+		h.RespondInternalError(c, err, 11001)
+		return
+	}
+
+	jsonData, err := json.Marshal(pending)
+	if err != nil {
+		h.RespondInternalError(c, err, 11002)
+		return
+	}
+	csrfToken, err := h.csrfToken(c)
+	if err != nil {
+		h.RespondInternalError(c, err, 11009)
+		return
+	}
+
+	// Key format: consent_request:{id}
+	if err := h.RedisClient.Set(c, "consent_request:"+id, jsonData, consentRequestExpiry).Err(); err != nil {
+		h.RespondInternalError(c, err, 11003)
+		return
+	}
+
+	h.renderPage(c, http.StatusOK, "consent", consentPage{
+		Title:          "Authorize " + client.Name,
+		ClientName:     client.Name,
+		Scopes:         utils.ParseScope(pending.Request.Scope),
+		Action:         h.endpointURL("/oauth/authorize/consent"),
+		ConsentRequest: id,
+		CSRFToken:      csrfToken,
+	})
+}
+
+// AuthorizeConsent records the user's decision on the consent page and finishes the authorization
+func (h *Handler) AuthorizeConsent(c *gin.Context) {
+	var form ConsentForm
+	if err := c.ShouldBind(&form); err != nil || form.ConsentRequest == "" {
+		h.RespondError(c, http.StatusBadRequest, err, "Invalid consent request")
+		return
+	}
+	renderError := func(status int, err error, message string) {
+		traceID, _ := c.Get(middleware.TraceIDKey)
+		slog.Warn("Client Error", "status", status, "message", message, "error", err, "trace_id", traceID)
+		h.renderPage(c, status, "message", messagePage{Title: "Authorize", Error: message})
+	}
+
+	if !checkCSRFToken(c) {
+		renderError(http.StatusForbidden, nil, "Your consent form expired, please try again")
+		return
+	}
+
+	// 1. Load and consume the pending request
+	val, err := h.RedisClient.GetDel(c, "consent_request:"+form.ConsentRequest).Result()
+	if err != nil {
+		h.RespondError(c, http.StatusBadRequest, err, "Invalid or expired consent request")
+		return
+	}
+
+	var pending consentRequest
+	if err := json.Unmarshal([]byte(val), &pending); err != nil {
+		h.RespondInternalError(c, err, 11004)
+		return
+	}
+	req := &pending.Request
+
+	// 2. Only the session that was asked may answer, and only while it is still signed in
+	session, err := h.currentSession(c)
+	if err != nil {
+		h.RespondInternalError(c, err, 11010)
+		return
+	}
+	if session == nil || session.ID != pending.SessionID || session.UserID != pending.UserID {
+		renderError(http.StatusForbidden, nil, "Your session has changed, please sign in again")
+		return
+	}
+
+	// 3. The client or its redirect URIs may have changed in the meantime
+	client, authErr := h.validateAuthorizeRequest(c, req)
+	if authErr != nil {
+		h.respondAuthorizeError(c, req, authErr)
+		return
+	}
+
+	if form.Action != "approve" {
+		h.respondAuthorizeError(c, req, &authorizeError{redirect: true, code: "access_denied", description: "The user denied the request"})
+		return
+	}
+
+	// 4. Record Consent
+	if err := h.grantConsent(c, pending.UserID, client.ID.String(), req.Scope); err != nil {
+		h.RespondInternalError(c, err, 11005)
+		return
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("Consent granted", "user_id", pending.UserID, "client_id", client.ID, "scope", req.Scope, "trace_id", traceID)
+	h.completeAuthorization(c, client, req, session)
+}
+
+// ListConsents returns the clients the authenticated user has authorized
+func (h *Handler) ListConsents(c *gin.Context) {
+	userID, ok := h.authenticateConsentManager(c)
+	if !ok {
+		return
+	}
+
+	var consents []models.Consent
+	if err := h.DB.Preload("Client").Where("user_id = ?", userID).Order("granted_at desc").Find(&consents).Error; err != nil {
+		h.RespondInternalError(c, err, 11006)
+		return
+	}
+
+	response := make([]gin.H, 0, len(consents))
+	for _, consent := range consents {
+		response = append(response, gin.H{
+			"client_id":   consent.ClientID,
+			"client_name": consent.Client.Name,
+			"scope":       consent.Scopes,
+			"granted_at":  consent.GrantedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeConsent removes the user's consent for a client and invalidates the refresh tokens it holds for the user
+func (h *Handler) RevokeConsent(c *gin.Context) {
+	userID, ok := h.authenticateConsentManager(c)
+	if !ok {
+		return
+	}
+	clientID := c.Param("client_id")
+	if _, err := uuid.Parse(clientID); err != nil {
+		h.RespondError(c, http.StatusNotFound, err, "Consent not found")
+		return
+	}
+
+	result := h.DB.Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&models.Consent{})
+	if result.Error != nil {
+		h.RespondInternalError(c, result.Error, 11007)
+		return
+	}
+	if result.RowsAffected == 0 {
+		h.RespondError(c, http.StatusNotFound, nil, "Consent not found")
+		return
+	}
+
+	if err := h.revokeUserRefreshTokens(c, userID, clientID); err != nil {
+		h.RespondInternalError(c, err, 11008)
+		return
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("Consent revoked", "user_id", userID, "client_id", clientID, "trace_id", traceID)
+	c.Status(http.StatusNoContent)
+}
+
+// authenticateConsentManager authenticates a request to manage the user's consents and returns the user ID.
+// The access token must carry the consents scope.
+func (h *Handler) authenticateConsentManager(c *gin.Context) (string, bool) {
+	claims, userID, ok := h.authenticateUser(c)
+	if !ok {
+		return "", false
+	}
+	if !h.requireScope(c, claims, consentsScope) {
+		return "", false
+	}
+	return userID, true
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"auth-system/internal/utils"
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Forms rendered by the server are protected with a double-submit token: the form carries the
+// same random token as the CSRF cookie, which a cross-site page can neither read nor set.
+
+const (
+	csrfCookieName = "auth_csrf"
+	csrfFieldName  = "csrf_token"
+)
+
+// csrfToken returns the CSRF token of the browser, issuing a new one in a cookie when it has none
+func (h *Handler) csrfToken(c *gin.Context) (string, error) {
+	if token, err := c.Cookie(csrfCookieName); err == nil && token != "" {
+		return token, nil
+	}
+
+	token, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+	h.setCookie(c, csrfCookieName, token, 0)
+	return token, nil
+}
+
+// checkCSRFToken reports whether the submitted form carries the CSRF token of the browser
+func checkCSRFToken(c *gin.Context) bool {
+	cookie, err := c.Cookie(csrfCookieName)
+	if err != nil || cookie == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(c.PostForm(csrfFieldName))) == 1
+}
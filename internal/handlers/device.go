@@ -0,0 +1,465 @@
+package handlers
+
+import (
+	"auth-system/internal/middleware"
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	deviceCodeExpiry = 10 * time.Minute
+	// Minimum seconds between polls, raised by 5 every time the device polls too fast
+	devicePollInterval = 5
+)
+
+const (
+	deviceStatusPending  = "pending"
+	deviceStatusApproved = "approved"
+	deviceStatusDenied   = "denied"
+)
+
+var (
+	// errDeviceCodeDecided is returned for a user code whose grant was already approved or denied
+	errDeviceCodeDecided = errors.New("device code already decided")
+	// errDeviceCodeNotFound is returned for an unknown or expired user code
+	errDeviceCodeNotFound = errors.New("device code not found")
+)
+
+type DeviceAuthorizationRequest struct {
+	Scope    string `form:"scope" json:"scope"`
+	Resource string `form:"resource" json:"resource"`
+}
+
+type DeviceVerificationForm struct {
+	UserCode string `form:"user_code"`
+	ClientID string `form:"client_id"` // The client the page showed the user
+	Email    string `form:"email"`
+	Password string `form:"password"`
+	Action   string `form:"action"`
+}
+
+type DeviceCodeData struct {
+	ClientID  string `json:"client_id"`
+	UserCode  string `json:"user_code"`
+	Scope     string `json:"scope,omitempty"`
+	Resource  string `json:"resource,omitempty"`
+	Status    string `json:"status"`
+	UserID    string `json:"user_id,omitempty"`
+	AuthTime  int64  `json:"auth_time,omitempty"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type devicePage struct {
+	Title      string
+	Error      string
+	UserCode   string
+	Email      string
+	ClientID   string
+	ClientName string
+	Scopes     []string
+	CSRFToken  string
+}
+
+// decideDeviceCodeScript stores the user's decision only while the grant is still pending, so two
+// concurrent submissions cannot both decide it. Returns 1 on success and 0 when it was already decided.
+var decideDeviceCodeScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if not current or cjson.decode(current)['status'] ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'KEEPTTL')
+return 1
+`)
+
+// DeviceAuthorization starts an RFC 8628 device authorization grant
+func (h *Handler) DeviceAuthorization(c *gin.Context) {
+	// 1. Authenticate Client
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	if !client.AllowsGrantType(deviceGrantType) {
+		h.RespondOAuthError(c, http.StatusBadRequest, nil, "unauthorized_client", "Client is not allowed to use grant type "+deviceGrantType)
+		return
+	}
+
+	// 2. Read Request
+	var req DeviceAuthorizationRequest
+	if h.BindFormWithValidation(c, &req) {
+		return
+	}
+
+	scope := req.Scope
+	if scope == "" {
+		scope = client.Scopes
+	}
+	if !utils.ScopeSubset(scope, client.Scopes) {
+		h.RespondOAuthError(c, http.StatusBadRequest, nil, "invalid_scope", "Requested scope exceeds the client's scope")
+		return
+	}
+	if _, err := h.lookupResource(c, client, req.Resource); errors.Is(err, errInvalidTarget) {
+		h.RespondOAuthError(c, http.StatusBadRequest, err, "invalid_target", "Unknown resource or not allowed for this client")
+		return
+	} else if err != nil {
+		h.RespondInternalError(c, err, 20008)
+		return
+	}
+
+	// 3. Generate Codes
+	deviceCode, err := utils.GenerateRandomString(32)
+	if err != nil {
+		h.RespondInternalError(c, err, 10001)
+		return
+	}
+	userCode, err := utils.GenerateUserCode()
+	if err != nil {
+		h.RespondInternalError(c, err, 10002)
+		return
+	}
+
+	data := DeviceCodeData{
+		ClientID:  client.ID.String(),
+		UserCode:  userCode,
+		Scope:     scope,
+		Resource:  req.Resource,
+		Status:    deviceStatusPending,
+		ExpiresAt: time.Now().Add(deviceCodeExpiry).Unix(),
+	}
+
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		h.RespondInternalError(c, err, 10003)
+		return
+	}
+
+	// 4. Store in Redis
+	// Key format: device_code:{device_code} -> data, device_user_code:{user_code} -> device_code
+	// Polling state lives in its own key so polls never overwrite the user's decision
+	pipe := h.RedisClient.TxPipeline()
+	pipe.Set(c, "device_code:"+deviceCode, jsonData, deviceCodeExpiry)
+	pipe.Set(c, "device_user_code:"+userCode, deviceCode, deviceCodeExpiry)
+	pipe.HSet(c, "device_poll:"+deviceCode, "interval", devicePollInterval, "last_polled_at", 0)
+	pipe.Expire(c, "device_poll:"+deviceCode, deviceCodeExpiry)
+	if _, err := pipe.Exec(c); err != nil {
+		h.RespondInternalError(c, err, 10004)
+		return
+	}
+
+	verificationURI := h.endpointURL("/device")
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("Device authorization started", "client_id", client.ID, "trace_id", traceID)
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"device_code":               deviceCode,
+		"user_code":                 userCode,
+		"verification_uri":          verificationURI,
+		"verification_uri_complete": verificationURI + "?user_code=" + url.QueryEscape(userCode),
+		"expires_in":                int(deviceCodeExpiry.Seconds()),
+		"interval":                  devicePollInterval,
+	})
+}
+
+// DeviceVerification renders the page where the user enters the code shown on the device.
+// When the link carried the code, the page already shows the client requesting access.
+func (h *Handler) DeviceVerification(c *gin.Context) {
+	page := devicePage{Title: "Connect a device", UserCode: utils.NormalizeUserCode(c.Query("user_code"))}
+	if page.UserCode != "" {
+		_, data, client, err := h.pendingDeviceGrant(c, page.UserCode)
+		if err == nil {
+			page.setClient(client, data)
+		} else if !errors.Is(err, errDeviceCodeNotFound) && !errors.Is(err, errDeviceCodeDecided) {
+			h.RespondInternalError(c, err, 10011)
+			return
+		}
+	}
+	h.renderDevicePage(c, http.StatusOK, page)
+}
+
+// DeviceVerificationSubmit authenticates the user and approves or denies the pending device grant
+func (h *Handler) DeviceVerificationSubmit(c *gin.Context) {
+	var form DeviceVerificationForm
+	if err := c.ShouldBind(&form); err != nil {
+		h.RespondError(c, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	userCode := utils.NormalizeUserCode(form.UserCode)
+
+	page := devicePage{Title: "Connect a device", UserCode: userCode, Email: form.Email}
+	renderError := func(status int, err error, message string) {
+		traceID, _ := c.Get(middleware.TraceIDKey)
+		slog.Warn("Client Error", "status", status, "message", message, "error", err, "trace_id", traceID)
+		page.Error = message
+		h.renderDevicePage(c, status, page)
+	}
+
+	if !checkCSRFToken(c) {
+		renderError(http.StatusForbidden, nil, "Your sign-in form expired, please try again")
+		return
+	}
+
+	// 1. Resolve the pending grant from the user code
+	deviceCode, data, client, err := h.pendingDeviceGrant(c, userCode)
+	if errors.Is(err, errDeviceCodeDecided) {
+		renderError(http.StatusBadRequest, err, "This code has already been used")
+		return
+	}
+	if errors.Is(err, errDeviceCodeNotFound) {
+		renderError(http.StatusBadRequest, err, "Invalid or expired code")
+		return
+	}
+	if err != nil {
+		h.RespondInternalError(c, err, 10012)
+		return
+	}
+	page.setClient(client, data)
+
+	// The user must have seen which client is requesting access before deciding
+	if form.ClientID != data.ClientID {
+		renderError(http.StatusOK, nil, "Check the application requesting access, then sign in to approve it")
+		return
+	}
+
+	// 2. Authenticate User
+	user, err := h.checkUserCredentials(form.Email, form.Password)
+	if err != nil {
+		renderError(http.StatusUnauthorized, err, "Invalid email or password")
+		return
+	}
+
+	// 3. Record the decision
+	message := "Your device has been connected. You can return to it now."
+	if form.Action == "deny" {
+		data.Status = deviceStatusDenied
+		message = "The device was not connected."
+	} else {
+		data.Status = deviceStatusApproved
+		data.UserID = user.ID.String()
+		data.AuthTime = time.Now().Unix()
+	}
+
+	decided, err := h.decideDeviceCode(c, deviceCode, data)
+	if err != nil {
+		h.RespondInternalError(c, err, 10005)
+		return
+	}
+	if !decided {
+		renderError(http.StatusBadRequest, nil, "This code has already been used")
+		return
+	}
+	if data.Status == deviceStatusApproved {
+		// Approving the device is the user's consent to the scope it requested
+		if err := h.grantConsent(c, data.UserID, data.ClientID, data.Scope); err != nil {
+			h.RespondInternalError(c, err, 10009)
+			return
+		}
+	}
+	// The user code can only be used once
+	if err := h.RedisClient.Del(c, "device_user_code:"+userCode).Err(); err != nil {
+		h.RespondInternalError(c, err, 10013)
+		return
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("Device authorization decided", "user_id", user.ID, "client_id", data.ClientID, "status", data.Status, "trace_id", traceID)
+	h.renderPage(c, http.StatusOK, "message", messagePage{Title: "Connect a device", Message: message})
+}
+
+// deviceCodeGrant is polled by the device until the user has approved or denied the request
+func (h *Handler) deviceCodeGrant(c *gin.Context, client *models.Client, req *TokenRequest) {
+	if req.DeviceCode == "" {
+		h.respondMissingTokenParameter(c, "device_code")
+		return
+	}
+
+	// 1. Load the pending grant
+	data, err := h.getDeviceCodeData(c, req.DeviceCode)
+	if errors.Is(err, redis.Nil) {
+		h.respondTokenError(c, http.StatusBadRequest, err, "expired_token", "The device code has expired")
+		return
+	}
+	if err != nil {
+		h.RespondInternalError(c, err, 10006)
+		return
+	}
+
+	if data.ClientID != client.ID.String() {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_grant", "Invalid device code for this client")
+		return
+	}
+	resource, ok := grantedResource(data.Resource, req.Resource)
+	if !ok {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_target", "resource does not match the device authorization request")
+		return
+	}
+
+	// 2. Enforce the polling interval
+	if data.Status == deviceStatusPending {
+		slowDown, err := h.recordDevicePoll(c, req.DeviceCode)
+		if err != nil {
+			h.RespondInternalError(c, err, 10007)
+			return
+		}
+		if slowDown {
+			h.respondTokenError(c, http.StatusBadRequest, nil, "slow_down", "Polling too frequently")
+			return
+		}
+		h.respondTokenError(c, http.StatusBadRequest, nil, "authorization_pending", "The user has not yet decided")
+		return
+	}
+
+	// 3. The grant is decided: consume it so it cannot be redeemed twice
+	deleted, err := h.RedisClient.Del(c, "device_code:"+req.DeviceCode).Result()
+	if err != nil {
+		h.RespondInternalError(c, err, 10008)
+		return
+	}
+	if deleted == 0 {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "expired_token", "The device code has expired")
+		return
+	}
+	h.RedisClient.Del(c, "device_poll:"+req.DeviceCode)
+
+	if data.Status == deviceStatusDenied {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "access_denied", "The user denied the request")
+		return
+	}
+
+	// 4. Generate Tokens
+	response, ok := h.issueUserTokens(c, client, userGrant{
+		UserID:   data.UserID,
+		Scope:    data.Scope,
+		Resource: resource,
+		AuthTime: data.AuthTime,
+		Binding:  req.Binding,
+	})
+	if !ok {
+		return
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("Device code exchanged", "client_id", client.ID, "user_id", data.UserID, "trace_id", traceID)
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) getDeviceCodeData(ctx context.Context, deviceCode string) (*DeviceCodeData, error) {
+	val, err := h.RedisClient.Get(ctx, "device_code:"+deviceCode).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var data DeviceCodeData
+	if err := json.Unmarshal([]byte(val), &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// recordDevicePoll stores the poll time and reports whether the device polled faster than its interval,
+// in which case the interval is raised by 5 seconds as required by RFC 8628 Section 3.5
+func (h *Handler) recordDevicePoll(ctx context.Context, deviceCode string) (bool, error) {
+	key := "device_poll:" + deviceCode
+	state, err := h.RedisClient.HMGet(ctx, key, "interval", "last_polled_at").Result()
+	if err != nil {
+		return false, err
+	}
+
+	interval, lastPolledAt := devicePollInterval, int64(0)
+	if v, ok := state[0].(string); ok {
+		interval, _ = strconv.Atoi(v)
+	}
+	if v, ok := state[1].(string); ok {
+		lastPolledAt, _ = strconv.ParseInt(v, 10, 64)
+	}
+
+	now := time.Now().Unix()
+	slowDown := lastPolledAt != 0 && now-lastPolledAt < int64(interval)
+	if slowDown {
+		interval += 5
+	}
+
+	if err := h.RedisClient.HSet(ctx, key, "interval", interval, "last_polled_at", now).Err(); err != nil {
+		return false, err
+	}
+	return slowDown, nil
+}
+
+// pendingDeviceGrant resolves a user code to the device code, grant and client it belongs to.
+// It returns errDeviceCodeNotFound for unknown or expired codes and errDeviceCodeDecided when the user
+// already approved or denied the grant; any other error is a backend failure.
+func (h *Handler) pendingDeviceGrant(ctx context.Context, userCode string) (string, *DeviceCodeData, *models.Client, error) {
+	deviceCode, err := h.RedisClient.Get(ctx, "device_user_code:"+userCode).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil, nil, errDeviceCodeNotFound
+	}
+	if err != nil {
+		return "", nil, nil, err
+	}
+	data, err := h.getDeviceCodeData(ctx, deviceCode)
+	if errors.Is(err, redis.Nil) {
+		return "", nil, nil, errDeviceCodeNotFound
+	}
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if data.Status != deviceStatusPending {
+		return "", nil, nil, errDeviceCodeDecided
+	}
+
+	var client models.Client
+	err = h.DB.WithContext(ctx).Where("id = ?", data.ClientID).First(&client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// The client was deleted after starting the grant
+		return "", nil, nil, errDeviceCodeNotFound
+	}
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return deviceCode, data, &client, nil
+}
+
+// decideDeviceCode stores the user's decision without extending the grant's expiry.
+// It reports false when the grant was decided concurrently.
+func (h *Handler) decideDeviceCode(ctx context.Context, deviceCode string, data *DeviceCodeData) (bool, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return false, err
+	}
+	res, err := decideDeviceCodeScript.Run(ctx, h.RedisClient, []string{"device_code:" + deviceCode}, deviceStatusPending, jsonData).Int()
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
+
+// renderDevicePage renders the device verification page with the CSRF token of the browser
+func (h *Handler) renderDevicePage(c *gin.Context, status int, page devicePage) {
+	token, err := h.csrfToken(c)
+	if err != nil {
+		h.RespondInternalError(c, err, 10010)
+		return
+	}
+	page.CSRFToken = token
+	h.renderPage(c, status, "device", page)
+}
+
+func (p *devicePage) setClient(client *models.Client, data *DeviceCodeData) {
+	p.ClientID = data.ClientID
+	p.ClientName = client.Name
+	p.Scopes = utils.ParseScope(data.Scope)
+}
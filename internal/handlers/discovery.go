@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OpenIDConfiguration struct {
+	Issuer                                     string   `json:"issuer"`
+	AuthorizationEndpoint                      string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                              string   `json:"token_endpoint"`
+	UserInfoEndpoint                           string   `json:"userinfo_endpoint"`
+	JWKSURI                                    string   `json:"jwks_uri"`
+	IntrospectionEndpoint                      string   `json:"introspection_endpoint"`
+	RevocationEndpoint                         string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint                string   `json:"device_authorization_endpoint"`
+	PushedAuthorizationRequestEndpoint         string   `json:"pushed_authorization_request_endpoint"`
+	RegistrationEndpoint                       string   `json:"registration_endpoint"`
+	EndSessionEndpoint                         string   `json:"end_session_endpoint"`
+	BackchannelLogoutSupported                 bool     `json:"backchannel_logout_supported"`
+	ScopesSupported                            []string `json:"scopes_supported"`
+	ResponseTypesSupported                     []string `json:"response_types_supported"`
+	PromptValuesSupported                      []string `json:"prompt_values_supported"`
+	SubjectTypesSupported                      []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported           []string `json:"id_token_signing_alg_values_supported"`
+	GrantTypesSupported                        []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	TLSClientCertificateBoundAccessTokens      bool     `json:"tls_client_certificate_bound_access_tokens"`
+	DPoPSigningAlgValuesSupported              []string `json:"dpop_signing_alg_values_supported"`
+	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                            []string `json:"claims_supported"`
+	RequestParameterSupported                  bool     `json:"request_parameter_supported"`
+	RequestURIParameterSupported               bool     `json:"request_uri_parameter_supported"`
+	RequireRequestURIRegistration              bool     `json:"require_request_uri_registration"`
+	RequestObjectSigningAlgValuesSupported     []string `json:"request_object_signing_alg_values_supported"`
+}
+
+// endpointURL builds the public URL of a route relative to the API base path
+func (h *Handler) endpointURL(path string) string {
+	return h.Config.Issuer + path
+}
+
+// requestURL is the public URL of the current request, without its query
+func (h *Handler) requestURL(c *gin.Context) string {
+	u, err := url.Parse(h.Config.Issuer)
+	if err != nil {
+		return ""
+	}
+	u.Path = c.Request.URL.Path
+	u.RawPath = ""
+	return u.String()
+}
+
+func (h *Handler) OpenIDConfiguration(c *gin.Context) {
+	subjectTypesSupported := []string{subjectTypePublic}
+	if h.Config.PairwiseSubjectSalt != "" {
+		subjectTypesSupported = append(subjectTypesSupported, subjectTypePairwise)
+	}
+
+	c.JSON(http.StatusOK, OpenIDConfiguration{
+		Issuer:                                     h.Config.Issuer,
+		AuthorizationEndpoint:                      h.endpointURL("/oauth/authorize"),
+		TokenEndpoint:                              h.endpointURL("/oauth/token"),
+		UserInfoEndpoint:                           h.endpointURL("/userinfo"),
+		JWKSURI:                                    h.endpointURL("/.well-known/jwks.json"),
+		IntrospectionEndpoint:                      h.endpointURL("/oauth/introspect"),
+		RevocationEndpoint:                         h.endpointURL("/oauth/revoke"),
+		DeviceAuthorizationEndpoint:                h.endpointURL("/oauth/device_authorization"),
+		PushedAuthorizationRequestEndpoint:         h.endpointURL("/oauth/par"),
+		RegistrationEndpoint:                       h.endpointURL("/oauth/register"),
+		EndSessionEndpoint:                         h.endpointURL("/oauth/logout"),
+		BackchannelLogoutSupported:                 true,
+		ScopesSupported:                            utils.ParseScope(defaultClientScopes),
+		ResponseTypesSupported:                     []string{"code"},
+		PromptValuesSupported:                      []string{"none", "login", "consent"},
+		SubjectTypesSupported:                      subjectTypesSupported,
+		IDTokenSigningAlgValuesSupported:           []string{"RS256"},
+		GrantTypesSupported:                        supportedGrantTypes,
+		TokenEndpointAuthMethodsSupported:          tokenEndpointAuthMethods,
+		TokenEndpointAuthSigningAlgValuesSupported: utils.AsymmetricSigningAlgs,
+		TLSClientCertificateBoundAccessTokens:      true,
+		DPoPSigningAlgValuesSupported:              utils.AsymmetricSigningAlgs,
+		CodeChallengeMethodsSupported:              []string{"S256"},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "amr",
+			"email", "email_verified", "name", "given_name", "family_name", "updated_at",
+		},
+		RequestParameterSupported:              true,
+		RequestURIParameterSupported:           true,
+		RequireRequestURIRegistration:          true,
+		RequestObjectSigningAlgValuesSupported: utils.AsymmetricSigningAlgs,
+	})
+}
+
+func (h *Handler) JWKS(c *gin.Context) {
+	var clients []models.Client
+	if err := h.DB.Select("id", "public_key").Find(&clients).Error; err != nil {
+		h.RespondInternalError(c, err, 6001)
+		return
+	}
+
+	keys := make([]utils.JWK, 0, len(clients))
+	for _, client := range clients {
+		jwk, err := utils.PublicKeyPEMToJWK(client.PublicKey)
+		if err != nil {
+			h.RespondInternalError(c, err, 6002)
+			return
+		}
+		keys = append(keys, jwk)
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.JWKS{Keys: keys})
+}
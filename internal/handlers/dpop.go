@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"auth-system/internal/utils"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DPoP proofs are only accepted shortly after they were created, and remembered that long to detect replay
+	dpopProofMaxAge = 5 * time.Minute
+	dpopClockSkew   = time.Minute
+)
+
+// checkDPoPProof validates the DPoP proof header of the request (RFC 9449 Section 4.3) and returns the
+// thumbprint of its key, or an empty string when the request has no proof. accessToken is set when the
+// proof accompanies an access token at a protected resource.
+func (h *Handler) checkDPoPProof(c *gin.Context, accessToken string) (string, *oauthError) {
+	invalid := func(err error, description string) *oauthError {
+		return &oauthError{status: http.StatusBadRequest, code: "invalid_dpop_proof", description: description, err: err}
+	}
+
+	proofs := c.Request.Header.Values("DPoP")
+	if len(proofs) == 0 {
+		return "", nil
+	}
+	if len(proofs) > 1 {
+		return "", invalid(nil, "Only one DPoP proof is allowed")
+	}
+
+	// 1. Verify Signature with the key in the proof
+	claims, jkt, err := utils.ValidateDPoPProof(proofs[0])
+	if err != nil {
+		return "", invalid(err, "Invalid DPoP proof")
+	}
+
+	// 2. The proof must be bound to this request
+	if htm, _ := claims["htm"].(string); htm != c.Request.Method {
+		return "", invalid(nil, "DPoP proof htm does not match the request method")
+	}
+	htu, _ := claims["htu"].(string)
+	if !h.matchesRequestURL(c, htu) {
+		return "", invalid(nil, "DPoP proof htu does not match the request URL")
+	}
+	if accessToken != "" {
+		if ath, _ := claims["ath"].(string); ath != utils.AccessTokenHash(accessToken) {
+			return "", invalid(nil, "DPoP proof ath does not match the access token")
+		}
+	}
+
+	// 3. The proof must be fresh
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return "", invalid(err, "DPoP proof iat is required")
+	}
+	if age := time.Since(iat.Time); age > dpopProofMaxAge || age < -dpopClockSkew {
+		return "", invalid(nil, "DPoP proof is too old or issued in the future")
+	}
+
+	// 4. Prevent Replay
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return "", invalid(nil, "DPoP proof jti is required")
+	}
+	// Key format: dpop_jti:{jkt}:{jti}
+	fresh, err := h.RedisClient.SetNX(c, "dpop_jti:"+jkt+":"+jti, "used", dpopProofMaxAge+dpopClockSkew).Result()
+	if err != nil {
+		return "", &oauthError{err: err, internalCode: 14001}
+	}
+	if !fresh {
+		return "", invalid(nil, "DPoP proof has already been used")
+	}
+
+	return jkt, nil
+}
+
+// matchesRequestURL compares an htu claim to the URL of the request, ignoring its query and fragment
+func (h *Handler) matchesRequestURL(c *gin.Context, htu string) bool {
+	u, err := url.Parse(htu)
+	if err != nil || htu == "" {
+		return false
+	}
+	u.RawQuery, u.Fragment = "", ""
+	u.Scheme, u.Host = strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+	return u.String() == h.requestURL(c)
+}
+
+// checkAccessTokenBinding enforces RFC 9449 Section 7 at protected resources: a DPoP-bound token must be
+// presented with the DPoP scheme and a proof signed with the bound key, and only bound tokens may use that
+// scheme. On failure it responds with Unauthorized and returns false.
+func (h *Handler) checkAccessTokenBinding(c *gin.Context, scheme, accessToken string, claims jwt.MapClaims) bool {
+	fail := func(err error, message string) bool {
+		c.Header("WWW-Authenticate", `DPoP error="invalid_dpop_proof", algs="`+strings.Join(utils.AsymmetricSigningAlgs, " ")+`"`)
+		h.RespondError(c, http.StatusUnauthorized, err, message)
+		return false
+	}
+
+	boundJKT := utils.ConfirmationJKT(claims)
+	if boundJKT == "" {
+		if scheme == "DPoP" {
+			return fail(nil, "Token is not DPoP-bound")
+		}
+		return true
+	}
+	if scheme != "DPoP" {
+		return fail(nil, "DPoP-bound token requires the DPoP authorization scheme")
+	}
+
+	jkt, dpopErr := h.checkDPoPProof(c, accessToken)
+	if dpopErr != nil {
+		if dpopErr.internalCode != 0 {
+			h.RespondInternalError(c, dpopErr.err, dpopErr.internalCode)
+			return false
+		}
+		return fail(dpopErr.err, dpopErr.description)
+	}
+	if jkt == "" {
+		return fail(nil, "DPoP proof required")
+	}
+	if jkt != boundJKT {
+		return fail(nil, "DPoP proof key does not match the token")
+	}
+	return true
+}
+
+// tokenType is the token_type of a token response, DPoP when the tokens are bound to a DPoP key
+func tokenType(jkt string) string {
+	if jkt != "" {
+		return "DPoP"
+	}
+	return "Bearer"
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"auth-system/internal/middleware"
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The clients a user signed into are remembered for as long as their refresh tokens live:
+// Key format: user_clients:{user_id} -> set of client_id
+
+const logoutTokenExpMinutes = 2
+
+type EndSessionRequest struct {
+	IDTokenHint           string `form:"id_token_hint"`
+	ClientID              string `form:"client_id"`
+	PostLogoutRedirectURI string `form:"post_logout_redirect_uri"`
+	State                 string `form:"state"`
+}
+
+func userClientsKey(userID string) string {
+	return "user_clients:" + userID
+}
+
+// recordSignedInClient remembers that the user signed into the client, so ending the user's session reaches it
+func (h *Handler) recordSignedInClient(ctx context.Context, userID, clientID string) error {
+	pipe := h.RedisClient.TxPipeline()
+	pipe.SAdd(ctx, userClientsKey(userID), clientID)
+	pipe.Expire(ctx, userClientsKey(userID), h.refreshTokenTTL())
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+type logoutPage struct {
+	Title      string
+	Error      string
+	ClientName string
+	Action     string
+	Hidden     map[string]string
+	CSRFToken  string
+}
+
+// EndSession implements OpenID Connect RP-Initiated Logout 1.0. It ends the session of the user
+// identified by the id_token_hint, notifies every client the user signed into over the back channel,
+// and redirects to the client's registered post_logout_redirect_uri if one was requested.
+// Unless the browser is signed in as that user, the user confirms the logout first.
+func (h *Handler) EndSession(c *gin.Context) {
+	page := messagePage{Title: "Sign out"}
+	renderError := func(err error, message string) {
+		traceID, _ := c.Get(middleware.TraceIDKey)
+		slog.Warn("Client Error", "status", http.StatusBadRequest, "message", message, "error", err, "trace_id", traceID)
+		page.Error = message
+		h.renderPage(c, http.StatusBadRequest, "message", page)
+	}
+
+	var req EndSessionRequest
+	if err := c.ShouldBind(&req); err != nil {
+		renderError(err, "Invalid logout request")
+		return
+	}
+	if req.IDTokenHint == "" {
+		renderError(nil, "id_token_hint is required")
+		return
+	}
+
+	// 1. Identify the user and client from the ID token
+	client, claims, err := h.validateIDTokenHint(c, req.IDTokenHint)
+	if err != nil {
+		renderError(err, "Invalid id_token_hint")
+		return
+	}
+	if req.ClientID != "" && req.ClientID != client.ID.String() {
+		renderError(nil, "client_id does not match the id_token_hint")
+		return
+	}
+	if req.PostLogoutRedirectURI != "" && !slices.Contains(client.PostLogoutRedirectURIs, req.PostLogoutRedirectURI) {
+		renderError(nil, "Unregistered post_logout_redirect_uri")
+		return
+	}
+
+	subject, _ := claims["sub"].(string)
+	userID, err := h.subjectUserID(c, client, subject)
+	if errors.Is(err, errUnknownSubject) {
+		renderError(err, "Invalid id_token_hint")
+		return
+	}
+	if err != nil {
+		h.RespondInternalError(c, err, 22004)
+		return
+	}
+
+	// 2. Anyone holding the ID token could otherwise sign the user out, so without a session of the same user
+	// the logout needs a confirmed form, and an ID token that has not expired
+	session, err := h.currentSession(c)
+	if err != nil {
+		h.RespondInternalError(c, err, 18002)
+		return
+	}
+	if session == nil || session.UserID != userID {
+		if exp, err := claims.GetExpirationTime(); err != nil || exp == nil || exp.Before(time.Now()) {
+			renderError(err, "The id_token_hint has expired")
+			return
+		}
+		if c.Request.Method != http.MethodPost || c.PostForm("action") != "logout" {
+			h.renderLogoutConfirmation(c, http.StatusOK, client, &req, "")
+			return
+		}
+		if !checkCSRFToken(c) {
+			h.renderLogoutConfirmation(c, http.StatusForbidden, client, &req, "Your sign-out form expired, please try again")
+			return
+		}
+	}
+
+	// 3. End the user's session everywhere
+	if err := h.endUserSession(c, userID, client.ID.String()); err != nil {
+		h.RespondInternalError(c, err, 18001)
+		return
+	}
+	h.setCookie(c, sessionCookieName, "", -1)
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("User session ended", "user_id", userID, "client_id", client.ID, "trace_id", traceID)
+
+	if req.PostLogoutRedirectURI != "" {
+		params := map[string]string{}
+		if req.State != "" {
+			params["state"] = req.State
+		}
+		c.Redirect(http.StatusFound, buildRedirectURL(req.PostLogoutRedirectURI, params))
+		return
+	}
+	page.Message = "You have been signed out."
+	h.renderPage(c, http.StatusOK, "message", page)
+}
+
+// renderLogoutConfirmation asks the user to confirm the logout, carrying the request through the form
+func (h *Handler) renderLogoutConfirmation(c *gin.Context, status int, client *models.Client, req *EndSessionRequest, message string) {
+	csrfToken, err := h.csrfToken(c)
+	if err != nil {
+		h.RespondInternalError(c, err, 18003)
+		return
+	}
+
+	hidden := map[string]string{"id_token_hint": req.IDTokenHint}
+	if req.PostLogoutRedirectURI != "" {
+		hidden["post_logout_redirect_uri"] = req.PostLogoutRedirectURI
+	}
+	if req.State != "" {
+		hidden["state"] = req.State
+	}
+	h.renderPage(c, status, "logout", logoutPage{
+		Title:      "Sign out",
+		Error:      message,
+		ClientName: client.Name,
+		Action:     h.endpointURL("/oauth/logout"),
+		Hidden:     hidden,
+		CSRFToken:  csrfToken,
+	})
+}
+
+// validateIDTokenHint verifies an ID token against the key of the client it was issued to
+func (h *Handler) validateIDTokenHint(ctx context.Context, idToken string) (*models.Client, jwt.MapClaims, error) {
+	token, _, err := new(jwt.Parser).ParseUnverified(idToken, jwt.MapClaims{})
+	if err != nil {
+		return nil, nil, err
+	}
+	aud, err := token.Claims.GetAudience()
+	if err != nil || len(aud) != 1 {
+		return nil, nil, fmt.Errorf("invalid token claims: aud")
+	}
+
+	var client models.Client
+	if err := h.DB.WithContext(ctx).Where("id = ?", aud[0]).First(&client).Error; err != nil {
+		return nil, nil, err
+	}
+
+	claims, err := utils.ValidateIDTokenHint(idToken, client.PublicKey, h.Config.Issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &client, claims, nil
+}
+
+// endUserSession ends the user's SSO sessions, revokes all of their refresh tokens and sends a back-channel
+// logout notification to every client the user signed into, including clientID
+func (h *Handler) endUserSession(ctx context.Context, userID, clientID string) error {
+	clientIDs, err := h.RedisClient.SMembers(ctx, userClientsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(clientIDs, clientID) {
+		clientIDs = append(clientIDs, clientID)
+	}
+
+	if err := h.endUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	if err := h.revokeUserRefreshTokens(ctx, userID, ""); err != nil {
+		return err
+	}
+	if err := h.RedisClient.Del(ctx, userClientsKey(userID)).Err(); err != nil {
+		return err
+	}
+
+	var clients []models.Client
+	if err := h.DB.WithContext(ctx).Where("id IN ? AND backchannel_logout_uri <> ''", clientIDs).Find(&clients).Error; err != nil {
+		return err
+	}
+
+	// Notifications are delivered in the background so a slow client cannot hold up the logout
+	subjects := make(map[string]string, len(clients))
+	for _, client := range clients {
+		subject, err := h.subjectFor(ctx, &client, userID)
+		if err != nil {
+			return err
+		}
+		subjects[client.ID.String()] = subject
+	}
+	return h.queueBackchannelLogouts(ctx, subjects, ctx.Value(middleware.TraceIDKey))
+}
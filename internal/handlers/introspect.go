@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"auth-system/internal/middleware"
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type IntrospectRequest struct {
+	Token         string `form:"token" json:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint" json:"token_type_hint"`
+}
+
+// Introspect implements RFC 7662 token introspection for access and refresh tokens
+func (h *Handler) Introspect(c *gin.Context) {
+	// 1. Authenticate Client
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	// 2. Read Request
+	var req IntrospectRequest
+	if h.BindFormWithValidation(c, &req) {
+		return
+	}
+
+	// 3. Try the hinted token type first, then fall back to the other one
+	lookups := []func(*gin.Context, *models.Client, string) (gin.H, error){h.introspectAccessToken, h.introspectRefreshToken}
+	if req.TokenTypeHint == "refresh_token" {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	response := gin.H{"active": false}
+	for _, lookup := range lookups {
+		result, err := lookup(c, client, req.Token)
+		if err != nil {
+			h.RespondInternalError(c, err, 8001)
+			return
+		}
+		if result != nil {
+			response = result
+			break
+		}
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("Token introspected", "client_id", client.ID, "active", response["active"], "trace_id", traceID)
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+// introspectAccessToken returns the introspection response for a valid access token, or nil
+func (h *Handler) introspectAccessToken(c *gin.Context, _ *models.Client, token string) (gin.H, error) {
+	claims, client, err := h.validateAccessToken(c, token)
+	if errors.Is(err, errInvalidAccessToken) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	response := introspectionClaims(claims)
+	response["client_id"] = client.ID.String()
+	response["token_type"] = tokenType(utils.ConfirmationJKT(claims))
+	return response, nil
+}
+
+// introspectRefreshToken returns the introspection response for a valid, unblocked refresh token, or nil.
+// Refresh tokens are only disclosed to the client they were issued to.
+func (h *Handler) introspectRefreshToken(c *gin.Context, client *models.Client, token string) (gin.H, error) {
+	validToken, claims, err := utils.ValidateRefreshToken(token, h.Config.JWTSecret)
+	if err != nil || !validToken.Valid {
+		return nil, nil
+	}
+	if aud, _ := claims["aud"].(string); aud != client.ID.String() {
+		return nil, nil
+	}
+
+	blocked, err := h.isRefreshTokenBlocked(c, token)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, nil
+	}
+
+	current, err := h.isRefreshTokenCurrent(c, claims)
+	if err != nil {
+		return nil, err
+	}
+	if !current {
+		return nil, nil
+	}
+
+	response := introspectionClaims(claims)
+	response["client_id"] = claims["aud"]
+	response["token_type"] = "refresh_token"
+	return response, nil
+}
+
+func introspectionClaims(claims jwt.MapClaims) gin.H {
+	response := gin.H{"active": true}
+	for _, name := range []string{"iss", "jti", "sub", "aud", "exp", "iat", "nbf", "auth_time", "scope", "cnf", "act"} {
+		if value, ok := claims[name]; ok {
+			response[name] = value
+		}
+	}
+	return response
+}
@@ -6,6 +6,7 @@ import (
 	"auth-system/internal/utils"
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"time"
@@ -16,15 +17,24 @@ import (
 type LoginRequest struct {
 	ClientID      string `json:"client_id" binding:"required"`
 	CodeChallenge string `json:"code_challenge" binding:"required"`
+	RedirectURI   string `json:"redirect_uri"` // Optional, bound to the code when sent
 	Email         string `json:"email" binding:"required"`
 	Password      string `json:"password" binding:"required"`
+	Nonce         string `json:"nonce"`
+	Scope         string `json:"scope"`
 }
 
 type AuthCodeData struct {
-	ClientID      string `json:"client_id"`
-	UserID        string `json:"user_id"`
-	ExpiresAt     int64  `json:"expires_at"`
-	CodeChallenge string `json:"code_challenge"`
+	ClientID      string   `json:"client_id"`
+	UserID        string   `json:"user_id"`
+	ExpiresAt     int64    `json:"expires_at"`
+	CodeChallenge string   `json:"code_challenge"`
+	RedirectURI   string   `json:"redirect_uri,omitempty"`
+	Nonce         string   `json:"nonce,omitempty"`
+	Scope         string   `json:"scope,omitempty"`
+	Resource      string   `json:"resource,omitempty"`
+	AuthTime      int64    `json:"auth_time"`
+	AMR           []string `json:"amr,omitempty"`
 }
 
 func (h *Handler) Login(c *gin.Context) {
@@ -40,39 +50,111 @@ func (h *Handler) Login(c *gin.Context) {
 		h.RespondError(c, http.StatusUnauthorized, err, "Invalid Client ID")
 		return
 	}
-
-	// 2. Validate User
-	var user models.User
-	if err := h.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		h.RespondError(c, http.StatusUnauthorized, err, "Invalid credentials")
+	if !client.AllowsGrantType("authorization_code") {
+		h.RespondError(c, http.StatusBadRequest, nil, "unauthorized_client")
+		return
+	}
+	// Clients requiring pushed authorization requests must go through the authorization endpoint
+	if client.RequirePushedAuthorizationRequests {
+		h.RespondError(c, http.StatusBadRequest, nil, "This client must use pushed authorization requests")
+		return
+	}
+	// A login request cannot carry a request object, so clients requiring one must use the authorization endpoint too
+	if client.RequireSignedRequestObject {
+		h.RespondError(c, http.StatusBadRequest, nil, "This client must use signed request objects")
+		return
+	}
+	if req.RedirectURI != "" && !utils.MatchRedirectURI(client.RedirectURIs, req.RedirectURI) {
+		h.RespondError(c, http.StatusBadRequest, nil, "redirect_uri is not registered for this client")
 		return
 	}
 
-	if !utils.CheckPassword(req.Password, user.Password) {
-		h.RespondError(c, http.StatusUnauthorized, nil, "Invalid credentials")
+	// Grant the requested scope, or every scope the client is allowed when none is requested
+	scope := req.Scope
+	if scope == "" {
+		scope = client.Scopes
+	}
+	if !utils.ScopeSubset(scope, client.Scopes) {
+		h.RespondError(c, http.StatusBadRequest, nil, "invalid_scope")
 		return
 	}
 
-	// 3. Generate Authorization Code
-	code, err := utils.GenerateRandomString(16)
+	// 2. Validate User
+	user, err := h.checkUserCredentials(req.Email, req.Password)
 	if err != nil {
-		h.RespondInternalError(c, err, 2001)
+		h.RespondError(c, http.StatusUnauthorized, err, "Invalid credentials")
 		return
 	}
 
-	expiresAt := time.Now().Add(time.Duration(h.Config.AuthCodeExp) * time.Minute).Unix()
+	// 3. Check Consent. The client cannot grant it for the user: the user gives it on the authorization endpoint's consent page.
+	consented, err := h.hasConsent(c, user.ID.String(), client.ID.String(), scope)
+	if err != nil {
+		h.RespondInternalError(c, err, 2005)
+		return
+	}
+	if !consented {
+		traceID, _ := c.Get(middleware.TraceIDKey)
+		slog.Warn("Client Error", "status", http.StatusForbidden, "message", "consent_required", "trace_id", traceID)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":                  "consent_required",
+			"client":                 client.Name,
+			"scope":                  scope,
+			"authorization_endpoint": h.endpointURL("/oauth/authorize"),
+		})
+		return
+	}
 
-	data := AuthCodeData{
+	// 4. Generate Authorization Code. The JSON login does not start an SSO session, only the login page does.
+	code, ok := h.issueAuthCode(c, AuthCodeData{
 		ClientID:      req.ClientID,
 		UserID:        user.ID.String(),
-		ExpiresAt:     expiresAt,
 		CodeChallenge: req.CodeChallenge,
+		RedirectURI:   req.RedirectURI,
+		Nonce:         req.Nonce,
+		Scope:         scope,
+		AuthTime:      time.Now().Unix(),
+		AMR:           []string{amrPassword},
+	})
+	if !ok {
+		return
 	}
 
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("User logged in", "user_id", user.ID, "client_id", client.ID, "trace_id", traceID	)
+	c.JSON(http.StatusOK, gin.H{"code": code})
+}
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// checkUserCredentials looks up a user by email and verifies the password
+func (h *Handler) checkUserCredentials(email, password string) (*models.User, error) {
+	var user models.User
+	if err := h.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	if !utils.CheckPassword(password, user.Password) {
+		return nil, errInvalidCredentials
+	}
+
+	return &user, nil
+}
+
+// issueAuthCode stores the authorization code data in Redis and returns the generated code.
+// On failure it responds with an internal error and returns false.
+func (h *Handler) issueAuthCode(c *gin.Context, data AuthCodeData) (string, bool) {
+	code, err := utils.GenerateRandomString(16)
+	if err != nil {
+		h.RespondInternalError(c, err, 2001)
+		return "", false
+	}
+
+	data.ExpiresAt = time.Now().Add(time.Duration(h.Config.AuthCodeExp) * time.Minute).Unix()
+
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		h.RespondInternalError(c, err, 2002)
-		return
+		return "", false
 	}
 
 	// Store in Redis
@@ -81,10 +163,8 @@ func (h *Handler) Login(c *gin.Context) {
 	err = h.RedisClient.Set(context.Background(), key, jsonData, time.Duration(h.Config.AuthCodeExp)*time.Minute).Err()
 	if err != nil {
 		h.RespondInternalError(c, err, 2003)
-		return
+		return "", false
 	}
 
-	traceID, _ := c.Get(middleware.TraceIDKey)
-	slog.Info("User logged in", "user_id", user.ID, "client_id", client.ID, "trace_id", traceID	)
-	c.JSON(http.StatusOK, gin.H{"code": code})
+	return code, true
 }
@@ -6,7 +6,6 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -35,27 +34,14 @@ func (h *Handler) Logout(c *gin.Context) {
 		return
 	}
 
-	// 3. Calculate TTL
-	var ttl time.Duration
-	if exp, ok := claims["exp"].(float64); ok {
-		expTime := time.Unix(int64(exp), 0)
-		ttl = time.Until(expTime)
-	} else {
-		// If exp claim is missing, block indefinitely.
-		// In go-redis, a duration of 0 means the key has no expiration time (persistent).
-		ttl = 0
-	}
-
-	// 4. Block Token in Redis
-	// Key format: blocked_refresh_token:{refresh_token}
-	key := "blocked_refresh_token:" + req.RefreshToken
-	err = h.RedisClient.Set(context.Background(), key, "blocked", ttl).Err()
+	// 3. Block Token in Redis until it expires
+	ttl, err := h.blockRefreshToken(context.Background(), req.RefreshToken, claims)
 	if err != nil {
 		h.RespondInternalError(c, err, 4001)
 		return
 	}
 
 	traceID, _ := c.Get(middleware.TraceIDKey)
-	slog.Info("RefreshToken blocked", "key", key, "ttl", ttl, "trace_id", traceID)
+	slog.Info("RefreshToken blocked", "ttl", ttl, "trace_id", traceID)
 	c.Status(http.StatusNoContent)
 }
@@ -1,82 +1,154 @@
 package handlers
 
 import (
+	"auth-system/internal/middleware"
 	"auth-system/internal/models"
-	"auth-system/internal/utils"
+	"encoding/json"
+	"log/slog"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 func (h *Handler) ClientMe(c *gin.Context) {
-	client, ok := h.authenticateClient(c)
+	client, ok := h.authenticateClientSecret(c)
 	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"name":       client.Name,
-		"public_key": client.PublicKey,
-	})
+	c.JSON(http.StatusOK, clientDetails(client))
 }
 
-func (h *Handler) UserMe(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		h.RespondError(c, http.StatusUnauthorized, nil, "Authorization header required")
-		return
+func clientDetails(client *models.Client) gin.H {
+	return gin.H{
+		"name":                       client.Name,
+		"public_key":                 client.PublicKey,
+		"redirect_uris":              client.RedirectURIs,
+		"scope":                      client.Scopes,
+		"token_endpoint_auth_method": client.TokenEndpointAuthMethod,
+		"jwks":                       clientJWKS(client),
+
+		"require_pushed_authorization_requests":      client.RequirePushedAuthorizationRequests,
+		"tls_client_auth_subject_dn":                 client.TLSClientAuthSubjectDN,
+		"tls_client_certificate_bound_access_tokens": client.TLSClientCertificateBoundAccessTokens,
+		"token_exchange_audiences":                   client.TokenExchangeAudiences,
+		"post_logout_redirect_uris":                  client.PostLogoutRedirectURIs,
+		"backchannel_logout_uri":                     client.BackchannelLogoutURI,
+		"request_uris":                               client.RequestURIs,
+		"require_signed_request_object":              client.RequireSignedRequestObject,
+		"allowed_resources":                          client.AllowedResources,
+		"subject_type":                               client.SubjectType,
 	}
+}
+
+type ClientUpdateRequest struct {
+	RedirectURIs            *[]string       `json:"redirect_uris"`
+	TokenEndpointAuthMethod *string         `json:"token_endpoint_auth_method" binding:"omitempty,oneof=client_secret_basic client_secret_post private_key_jwt tls_client_auth self_signed_tls_client_auth"`
+	JWKS                    json.RawMessage `json:"jwks"` // null removes the key set
+	RequirePAR              *bool           `json:"require_pushed_authorization_requests"`
+	TLSSubjectDN            *string         `json:"tls_client_auth_subject_dn"`
+	CertificateBoundTokens  *bool           `json:"tls_client_certificate_bound_access_tokens"`
+	PostLogoutRedirectURIs  *[]string       `json:"post_logout_redirect_uris"`
+	BackchannelLogoutURI    *string         `json:"backchannel_logout_uri"`
+	RequestURIs             *[]string       `json:"request_uris"`
+	RequireSignedRequest    *bool           `json:"require_signed_request_object"`
+	SubjectType             *string         `json:"subject_type"`
+}
 
-	parts := strings.Split(authHeader, " ")
-	if len(parts) != 2 || parts[0] != "Bearer" {
-		h.RespondError(c, http.StatusUnauthorized, nil, "Invalid authorization format")
+func (h *Handler) UpdateClient(c *gin.Context) {
+	client, ok := h.authenticateClientSecret(c)
+	if !ok {
 		return
 	}
 
-	tokenString := parts[1]
-
-	// 1. Parse Unverified to get Audience (Client ID)
-	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
+	var req ClientUpdateRequest
+	validationErrors, err := h.GetValidationErrors(c, &req)
 	if err != nil {
-		h.RespondError(c, http.StatusUnauthorized, err, "Invalid token")
+		h.RespondError(c, http.StatusBadRequest, err, "Invalid JSON")
 		return
 	}
+	if validationErrors == nil {
+		validationErrors = make(map[string]any)
+	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		h.RespondError(c, http.StatusUnauthorized, nil, "Invalid token")
-		return
+	if req.RedirectURIs != nil {
+		MergeErrors(validationErrors, validateRedirectURIs(*req.RedirectURIs))
 	}
 
-	clientID, ok := claims["aud"].(string)
-	if !ok {
-		h.RespondError(c, http.StatusUnauthorized, nil, "Invalid token")
-		return
+	// The auth method, key set and certificate subject are validated together, as they will be stored
+	method, jwks, subjectDN := client.TokenEndpointAuthMethod, client.JWKS, client.TLSClientAuthSubjectDN
+	if req.TokenEndpointAuthMethod != nil {
+		method = *req.TokenEndpointAuthMethod
+	}
+	if req.JWKS != nil {
+		jwks = jwksParam(req.JWKS)
 	}
+	if req.TLSSubjectDN != nil {
+		subjectDN = *req.TLSSubjectDN
+	}
+	MergeErrors(validationErrors, validateClientAuthentication(method, jwks, subjectDN))
+	postLogoutRedirectURIs, backchannelLogoutURI := client.PostLogoutRedirectURIs, client.BackchannelLogoutURI
+	if req.PostLogoutRedirectURIs != nil {
+		postLogoutRedirectURIs = *req.PostLogoutRedirectURIs
+	}
+	if req.BackchannelLogoutURI != nil {
+		backchannelLogoutURI = *req.BackchannelLogoutURI
+	}
+	MergeErrors(validationErrors, validateLogoutURIs(postLogoutRedirectURIs, backchannelLogoutURI))
+	requestURIs, requireSigned := client.RequestURIs, client.RequireSignedRequestObject
+	if req.RequestURIs != nil {
+		requestURIs = *req.RequestURIs
+	}
+	if req.RequireSignedRequest != nil {
+		requireSigned = *req.RequireSignedRequest
+	}
+	MergeErrors(validationErrors, validateRequestObjectSettings(requestURIs, requireSigned, jwks))
+	redirectURIs, subjectType := client.RedirectURIs, client.SubjectType
+	if req.RedirectURIs != nil {
+		redirectURIs = *req.RedirectURIs
+	}
+	if req.SubjectType != nil {
+		subjectType = *req.SubjectType
+	}
+	MergeErrors(validationErrors, h.validateSubjectType(subjectType))
+	MergeErrors(validationErrors, validateSubjectChange(client, subjectType, redirectURIs))
 
-	// 2. Fetch Client Public Key
-	var client models.Client
-	if err := h.DB.Where("id = ?", clientID).First(&client).Error; err != nil {
-		h.RespondError(c, http.StatusUnauthorized, err, "Invalid token")
+	if len(validationErrors) > 0 {
+		h.RespondValidationError(c, validationErrors)
 		return
 	}
 
-	// 3. Validate Token with Public Key
-	validToken, validClaims, err := utils.ValidateAccessToken(tokenString, client.PublicKey)
-	if err != nil || !validToken.Valid {
-		h.RespondError(c, http.StatusUnauthorized, err, "Invalid token")
+	if req.RedirectURIs != nil {
+		client.RedirectURIs = *req.RedirectURIs
+	}
+	client.TokenEndpointAuthMethod, client.JWKS, client.TLSClientAuthSubjectDN = method, jwks, subjectDN
+	if req.RequirePAR != nil {
+		client.RequirePushedAuthorizationRequests = *req.RequirePAR
+	}
+	if req.CertificateBoundTokens != nil {
+		client.TLSClientCertificateBoundAccessTokens = *req.CertificateBoundTokens
+	}
+	client.PostLogoutRedirectURIs, client.BackchannelLogoutURI = postLogoutRedirectURIs, backchannelLogoutURI
+	client.RequestURIs, client.RequireSignedRequestObject = requestURIs, requireSigned
+	client.SubjectType = subjectType
+
+	if err := h.DB.Save(client).Error; err != nil {
+		h.RespondInternalError(c, err, 6101)
 		return
 	}
 
-	// 4. Fetch User Details
-	userID, ok := validClaims["sub"].(string)
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("Client updated", "client_id", client.ID, "trace_id", traceID)
+	c.JSON(http.StatusOK, clientDetails(client))
+}
+
+func (h *Handler) UserMe(c *gin.Context) {
+	_, userID, ok := h.authenticateUser(c)
 	if !ok {
-		h.RespondError(c, http.StatusUnauthorized, nil, "Invalid token")
 		return
 	}
 
+	// Fetch User Details
 	var user models.User
 	if err := h.DB.Where("id = ?", userID).First(&user).Error; err != nil {
 		h.RespondError(c, http.StatusUnauthorized, err, "Invalid token")
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"crypto"
+	"crypto/x509"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// peerCertificates returns the client certificate chain of a mutual-TLS connection, leaf first
+func peerCertificates(c *gin.Context) []*x509.Certificate {
+	if c.Request.TLS == nil {
+		return nil
+	}
+	return c.Request.TLS.PeerCertificates
+}
+
+// clientFromCertificate authenticates the client with its TLS certificate (RFC 8705 Section 2): either a
+// certificate issued by a trusted CA with the registered subject DN, or a self-signed certificate whose key
+// is in the client's JWKS. It returns the method that authenticated the client.
+func (h *Handler) clientFromCertificate(clientID string, certs []*x509.Certificate) (*models.Client, string, *clientAuthError) {
+	var client models.Client
+	if err := h.DB.Where("id = ?", clientID).First(&client).Error; err != nil {
+		return nil, "", &clientAuthError{message: "Invalid Client", err: err}
+	}
+	leaf := certs[0]
+
+	switch client.TokenEndpointAuthMethod {
+	case authMethodTLSClientAuth:
+		if h.ClientCAs == nil {
+			return nil, "", &clientAuthError{message: "Mutual-TLS client authentication is not configured"}
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		if _, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         h.ClientCAs,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}); err != nil {
+			return nil, "", &clientAuthError{message: "Untrusted client certificate", err: err}
+		}
+		if client.TLSClientAuthSubjectDN == "" || leaf.Subject.String() != client.TLSClientAuthSubjectDN {
+			return nil, "", &clientAuthError{message: "Client certificate subject does not match"}
+		}
+
+	case authMethodSelfSignedTLSClientAuth:
+		now := time.Now()
+		if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+			return nil, "", &clientAuthError{message: "Client certificate is expired or not yet valid"}
+		}
+		if !clientJWKSContains(&client, leaf.PublicKey) {
+			return nil, "", &clientAuthError{message: "Client certificate is not registered"}
+		}
+
+	default:
+		return nil, "", &clientAuthError{message: "Client is not allowed to authenticate with a certificate"}
+	}
+
+	return &client, client.TokenEndpointAuthMethod, nil
+}
+
+// clientJWKSContains reports whether the public key is one of the client's registered keys
+func clientJWKSContains(client *models.Client, key crypto.PublicKey) bool {
+	jwks, err := utils.ParseJWKS([]byte(client.JWKS))
+	if err != nil {
+		return false
+	}
+	for _, jwk := range jwks.Keys {
+		registered, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		if k, ok := registered.(interface{ Equal(crypto.PublicKey) bool }); ok && k.Equal(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// certificateBinding returns the thumbprint of the client certificate when the client asked for
+// certificate-bound access tokens (RFC 8705 Section 3), which then require a mutual-TLS connection
+func (h *Handler) certificateBinding(c *gin.Context, client *models.Client) (string, *oauthError) {
+	if !client.TLSClientCertificateBoundAccessTokens {
+		return "", nil
+	}
+	certs := peerCertificates(c)
+	if len(certs) == 0 {
+		return "", &oauthError{status: http.StatusBadRequest, code: "invalid_request", description: "A client certificate is required for certificate-bound access tokens"}
+	}
+	return utils.CertificateThumbprint(certs[0]), nil
+}
+
+// checkCertificateBinding enforces RFC 8705 Section 3 at protected resources: a certificate-bound token is
+// only accepted over a connection presenting the same certificate. On failure it responds with Unauthorized
+// and returns false.
+func (h *Handler) checkCertificateBinding(c *gin.Context, claims jwt.MapClaims) bool {
+	x5t := utils.ConfirmationX5T(claims)
+	if x5t == "" {
+		return true
+	}
+
+	certs := peerCertificates(c)
+	if len(certs) == 0 || utils.CertificateThumbprint(certs[0]) != x5t {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		h.RespondError(c, http.StatusUnauthorized, nil, "Token is bound to a different client certificate")
+		return false
+	}
+	return true
+}
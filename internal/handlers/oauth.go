@@ -6,41 +6,198 @@ import (
 	"auth-system/internal/utils"
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
+// TokenRequest is read from application/x-www-form-urlencoded bodies as required by RFC 6749,
+// or from JSON bodies for backwards compatibility
 type TokenRequest struct {
-	Code         string `json:"code" binding:"required"`
-	CodeVerifier string `json:"code_verifier" binding:"required"` // Optional in strict prompt, but needed for PKCE
+	GrantType    string `form:"grant_type" json:"grant_type"`
+	Code         string `form:"code" json:"code"`
+	CodeVerifier string `form:"code_verifier" json:"code_verifier"` // Optional in strict prompt, but needed for PKCE
+	RedirectURI  string `form:"redirect_uri" json:"redirect_uri"`
+	Scope        string `form:"scope" json:"scope"`
+	Resource     string `form:"resource" json:"resource"` // RFC 8707 resource indicator
+	DeviceCode   string `form:"device_code" json:"device_code"`
+	RefreshToken string `form:"refresh_token" json:"refresh_token"`
+	// Token exchange parameters of RFC 8693 Section 2.1
+	SubjectToken       string       `form:"subject_token" json:"subject_token"`
+	SubjectTokenType   string       `form:"subject_token_type" json:"subject_token_type"`
+	ActorToken         string       `form:"actor_token" json:"actor_token"`
+	ActorTokenType     string       `form:"actor_token_type" json:"actor_token_type"`
+	Audience           string       `form:"audience" json:"audience"`
+	RequestedTokenType string       `form:"requested_token_type" json:"requested_token_type"`
+	Binding            tokenBinding `form:"-" json:"-"` // Set from the DPoP proof and client certificate of the request
 }
 
 type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
+	Scope        string `json:"scope"` // Optional subset of the originally granted scope
 }
 
+// supportedGrantTypes are the grant types the token endpoint implements
+var supportedGrantTypes = []string{"authorization_code", "refresh_token", "client_credentials", deviceGrantType, tokenExchangeGrantType}
+
+// oauthError is a failed grant shared by the token endpoint and the legacy JSON endpoints.
+// Internal errors carry their unique error code and are never described to the client.
+type oauthError struct {
+	status       int
+	code         string
+	description  string
+	err          error
+	internalCode int
+}
+
+func (h *Handler) respondOAuthError(c *gin.Context, e *oauthError) {
+	if e.internalCode != 0 {
+		h.RespondInternalError(c, e.err, e.internalCode)
+		return
+	}
+	h.respondTokenError(c, e.status, e.err, e.code, e.description)
+}
+
+// respondTokenError responds to a token request with an RFC 6749 error. JSON requests keep the errors the
+// JSON token endpoint always returned, as OAuthRefresh does: a rejected client is a 401 with its message,
+// anything else a 400 naming the error.
+func (h *Handler) respondTokenError(c *gin.Context, status int, err error, code, description string) {
+	if !isJSONRequest(c) {
+		h.RespondOAuthError(c, status, err, code, description)
+		return
+	}
+	switch code {
+	case "invalid_client":
+		h.RespondError(c, http.StatusUnauthorized, err, description)
+	case "invalid_request":
+		h.RespondError(c, http.StatusBadRequest, err, description)
+	default:
+		h.RespondError(c, http.StatusBadRequest, err, code)
+	}
+}
+
+// respondMissingTokenParameter reports a missing token request parameter, as a validation error to JSON requests
+func (h *Handler) respondMissingTokenParameter(c *gin.Context, name string) {
+	if isJSONRequest(c) {
+		h.RespondValidationError(c, map[string]any{name: "This field is required"})
+		return
+	}
+	h.RespondOAuthError(c, http.StatusBadRequest, nil, "invalid_request", name+" is required")
+}
+
+// isJSONRequest reports whether the token request uses the JSON body the endpoint accepted before RFC 6749 forms
+func isJSONRequest(c *gin.Context) bool {
+	return c.ContentType() == binding.MIMEJSON
+}
+
+// OAuthToken is the RFC 6749 token endpoint
 func (h *Handler) OAuthToken(c *gin.Context) {
+	// Token responses carry credentials and must never be cached
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
 	// 1. Authenticate Client
-	client, ok := h.authenticateClient(c)
-	if !ok {
+	client, authErr := h.clientFromRequest(c)
+	if authErr != nil {
+		if authErr.internalCode != 0 {
+			h.RespondInternalError(c, authErr.err, authErr.internalCode)
+			return
+		}
+		if _, _, ok := c.Request.BasicAuth(); ok {
+			c.Header("WWW-Authenticate", `Basic realm="token"`)
+		}
+		h.respondTokenError(c, http.StatusUnauthorized, authErr.err, "invalid_client", authErr.message)
 		return
 	}
 
 	// 2. Read Request
 	var req TokenRequest
-	if h.BindJSONWithValidation(c, &req) {
+	validationErrors, err := h.GetFormValidationErrors(c, &req)
+	if err != nil && isJSONRequest(c) {
+		h.RespondError(c, http.StatusBadRequest, err, "Invalid JSON")
+		return
+	}
+	if err != nil || len(validationErrors) > 0 {
+		h.respondTokenError(c, http.StatusBadRequest, err, "invalid_request", "Invalid request body")
 		return
 	}
+	for name, values := range c.Request.PostForm {
+		if len(values) > 1 {
+			h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_request", "Parameter "+name+" is repeated")
+			return
+		}
+	}
+
+	// Tokens issued with a DPoP proof are bound to its key, and to the client certificate if the client asked for it
+	jkt, oauthErr := h.checkDPoPProof(c, "")
+	if oauthErr != nil {
+		h.respondOAuthError(c, oauthErr)
+		return
+	}
+	x5t, oauthErr := h.certificateBinding(c, client)
+	if oauthErr != nil {
+		h.respondOAuthError(c, oauthErr)
+		return
+	}
+	req.Binding = tokenBinding{JKT: jkt, X5TS256: x5t}
+
+	// 3. Dispatch on grant_type. Requests without one are authorization code exchanges, as the JSON endpoint always accepted.
+	grantType := req.GrantType
+	if grantType == "" {
+		grantType = "authorization_code"
+	}
+	if !slices.Contains(supportedGrantTypes, grantType) {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "unsupported_grant_type", "Grant type "+grantType+" is not supported")
+		return
+	}
+	if !client.AllowsGrantType(grantType) {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "unauthorized_client", "Client is not allowed to use grant type "+grantType)
+		return
+	}
+
+	switch grantType {
+	case "authorization_code":
+		h.authorizationCodeGrant(c, client, &req)
+	case "refresh_token":
+		h.refreshTokenGrant(c, client, &req)
+	case "client_credentials":
+		h.clientCredentialsGrant(c, client, &req)
+	case deviceGrantType:
+		h.deviceCodeGrant(c, client, &req)
+	case tokenExchangeGrantType:
+		h.tokenExchangeGrant(c, client, &req)
+	}
+}
 
-	// 3. Check Redis for Code & Delete immediately (Atomic)
+func (h *Handler) authorizationCodeGrant(c *gin.Context, client *models.Client, req *TokenRequest) {
+	if req.Code == "" {
+		h.respondMissingTokenParameter(c, "code")
+		return
+	}
+	if req.CodeVerifier == "" {
+		h.respondMissingTokenParameter(c, "code_verifier")
+		return
+	}
+	// JSON requests keep the statuses and messages the JSON token endpoint returned for rejected codes
+	invalidGrant := func(legacyStatus int, err error, description string) {
+		if isJSONRequest(c) {
+			h.RespondError(c, legacyStatus, err, description)
+			return
+		}
+		h.RespondOAuthError(c, http.StatusBadRequest, err, "invalid_grant", description)
+	}
+
+	// 1. Check Redis for Code & Delete immediately (Atomic)
 	// Key format: auth_code:{code}
 	key := "auth_code:" + req.Code
 	val, err := h.RedisClient.GetDel(context.Background(), key).Result()
 	if err != nil {
-		h.RespondError(c, http.StatusUnauthorized, err, "Invalid or expired code")
+		invalidGrant(http.StatusUnauthorized, err, "Invalid or expired code")
 		return
 	}
 
@@ -52,114 +209,406 @@ func (h *Handler) OAuthToken(c *gin.Context) {
 
 	// Verify Code belongs to Client
 	if data.ClientID != client.ID.String() {
-		h.RespondError(c, http.StatusUnauthorized, nil, "Invalid code for this client")
+		invalidGrant(http.StatusUnauthorized, nil, "Invalid code for this client")
 		return
 	}
 
 	// Check expiry (Redis handles TTL but double check logic)
 	if time.Now().Unix() > data.ExpiresAt {
-		h.RespondError(c, http.StatusUnauthorized, nil, "Code expired")
+		invalidGrant(http.StatusUnauthorized, nil, "Code expired")
 		return
 	}
 
-	// Verify PKCE if verifier provided OR if challenge exists
-	// If challenge exists in Redis, verifier MUST be provided
-	if data.CodeChallenge != "" {
-		if req.CodeVerifier == "" {
-			h.RespondError(c, http.StatusBadRequest, nil, "code_verifier required")
-			return
-		}
-		if !utils.VerifyCodeChallenge(data.CodeChallenge, req.CodeVerifier) {
-			h.RespondError(c, http.StatusUnauthorized, nil, "Invalid code_verifier")
-			return
+	// The redirect_uri must be identical to the one used in the authorization request
+	if data.RedirectURI != "" && req.RedirectURI != data.RedirectURI {
+		invalidGrant(http.StatusBadRequest, nil, "redirect_uri does not match the authorization request")
+		return
+	}
+
+	// Verify PKCE: if a challenge exists in Redis, the verifier must match it
+	if data.CodeChallenge != "" && !utils.VerifyCodeChallenge(data.CodeChallenge, req.CodeVerifier) {
+		invalidGrant(http.StatusUnauthorized, nil, "Invalid code_verifier")
+		return
+	}
+
+	// The token request cannot switch to another resource than the one the user authorized
+	resource, ok := grantedResource(data.Resource, req.Resource)
+	if !ok {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_target", "resource does not match the authorization request")
+		return
+	}
+
+	// 2. Generate Tokens
+	response, ok := h.issueUserTokens(c, client, userGrant{
+		UserID:   data.UserID,
+		Scope:    data.Scope,
+		Resource: resource,
+		Nonce:    data.Nonce,
+		AuthTime: data.AuthTime,
+		AMR:      data.AMR,
+		Binding:  req.Binding,
+	})
+	if !ok {
+		return
+	}
+
+	// 3. Return Response
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("Token exchanged", "client_id", client.ID, "user_id", data.UserID, "trace_id", traceID)
+	c.JSON(http.StatusOK, response)
+}
+
+// userGrant describes what the user authorized, independent of the grant type used to obtain it
+type userGrant struct {
+	UserID   string
+	Scope    string
+	Resource string // Identifier of the API resource the access token is for, if any
+	Nonce    string
+	AuthTime int64
+	AMR      []string
+	Binding  tokenBinding
+}
+
+// tokenBinding holds what issued tokens are bound to: the DPoP proof key (RFC 9449)
+// and the client certificate (RFC 8705). Empty members leave the tokens unbound.
+type tokenBinding struct {
+	JKT     string
+	X5TS256 string
+}
+
+// issueUserTokens generates the access, refresh and ID tokens for a user grant.
+// On failure it responds with an internal error and returns false.
+func (h *Handler) issueUserTokens(c *gin.Context, client *models.Client, grant userGrant) (gin.H, bool) {
+	clientID := client.ID.String()
+
+	resource, err := h.lookupResource(c, client, grant.Resource)
+	if errors.Is(err, errInvalidTarget) {
+		h.respondTokenError(c, http.StatusBadRequest, err, "invalid_target", "Unknown resource or not allowed for this client")
+		return nil, false
+	}
+	if err != nil {
+		h.RespondInternalError(c, err, 20004)
+		return nil, false
+	}
+	audience, accessScope := resourceAccess(client, resource, grant.Scope)
+
+	// Pairwise clients know the user by an identifier of their own
+	subject, err := h.subjectFor(c, client, grant.UserID)
+	if err != nil {
+		h.RespondInternalError(c, err, 22002)
+		return nil, false
+	}
+	// From now on the client knows its users by these subjects, so how they are derived cannot change
+	if client.UserTokensIssuedAt == nil {
+		now := time.Now()
+		if err := h.DB.WithContext(c).Model(client).Update("user_tokens_issued_at", now).Error; err != nil {
+			h.RespondInternalError(c, err, 22005)
+			return nil, false
 		}
+		client.UserTokensIssuedAt = &now
 	}
 
-	// 4. Generate Tokens
-	
 	// Access Token: Sign with CLIENT's Private Key
-	accessToken, err := utils.GenerateAccessToken(client.PrivateKey, data.UserID, data.ClientID, h.Config.AccessTokenExp)
+	accessToken, err := utils.GenerateAccessToken(client.PrivateKey, utils.AccessTokenClaims{
+		Issuer:   h.Config.Issuer,
+		Subject:  subject,
+		ClientID: clientID,
+		Audience: audience,
+		Scope:    accessScope,
+		AuthTime: grant.AuthTime,
+		JKT:      grant.Binding.JKT,
+		X5TS256:  grant.Binding.X5TS256,
+	}, h.Config.AccessTokenExp)
 	if err != nil {
 		h.RespondInternalError(c, err, 3003)
-		return
+		return nil, false
+	}
+
+	// Remember the sign-in so ending the user's session logs the client out too
+	if err := h.recordSignedInClient(c, grant.UserID, clientID); err != nil {
+		h.RespondInternalError(c, err, 3012)
+		return nil, false
+	}
+
+	response := gin.H{
+		"access_token": accessToken,
+		"token_type":   tokenType(grant.Binding.JKT),
+		"expires_in":   h.Config.AccessTokenExp * 60,
+		"scope":        accessScope,
 	}
 
 	// Refresh Token: Sign with Server Symmetric Secret (Config.EncryptionKey or JWTSecret? Prompt says "environment variable")
-	// I'll use JWTSecret.
-	refreshToken, err := utils.GenerateRefreshToken(h.Config.JWTSecret, data.UserID, data.ClientID, h.Config.RefreshTokenExp)
+	// I'll use JWTSecret. Only clients allowed the refresh_token grant receive one.
+	if client.AllowsGrantType("refresh_token") {
+		refreshToken, err := h.issueRefreshToken(c, grant.UserID, utils.RefreshTokenClaims{
+			Subject:  subject,
+			ClientID: clientID,
+			Scope:    grant.Scope,
+			Resource: grant.Resource,
+			JKT:      grant.Binding.JKT,
+			AuthTime: grant.AuthTime,
+		})
+		if err != nil {
+			h.RespondInternalError(c, err, 3004)
+			return nil, false
+		}
+		response["refresh_token"] = refreshToken
+	}
+
+	// ID Token is only issued for OpenID Connect requests
+	if !utils.HasScope(grant.Scope, "openid") {
+		return response, true
+	}
+
+	// ID Token: Sign with the same CLIENT Private Key as the Access Token
+	var user models.User
+	if err := h.DB.Where("id = ?", grant.UserID).First(&user).Error; err != nil {
+		h.RespondInternalError(c, err, 3007)
+		return nil, false
+	}
+
+	idToken, err := utils.GenerateIDToken(client.PrivateKey, utils.IDTokenClaims{
+		Issuer:        h.Config.Issuer,
+		Subject:       subject,
+		Audience:      clientID,
+		AuthTime:      grant.AuthTime,
+		AMR:           grant.AMR,
+		Nonce:         grant.Nonce,
+		Email:         user.Email,
+		EmailVerified: user.Verified,
+		GivenName:     user.FirstName,
+		FamilyName:    user.LastName,
+	}, h.Config.AccessTokenExp)
 	if err != nil {
-		h.RespondInternalError(c, err, 3004)
+		h.RespondInternalError(c, err, 3008)
+		return nil, false
+	}
+
+	response["id_token"] = idToken
+	return response, true
+}
+
+// clientCredentialsGrant issues an access token to the client itself, without a refresh token
+func (h *Handler) clientCredentialsGrant(c *gin.Context, client *models.Client, req *TokenRequest) {
+	// 1. Restrict Scope to the client's allowed scopes, defaulting to all of them
+	scope := req.Scope
+	if scope == "" {
+		scope = client.Scopes
+	}
+	if !utils.ScopeSubset(scope, client.Scopes) {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_scope", "Requested scope exceeds the client's allowed scope")
+		return
+	}
+
+	resource, err := h.lookupResource(c, client, req.Resource)
+	if errors.Is(err, errInvalidTarget) {
+		h.respondTokenError(c, http.StatusBadRequest, err, "invalid_target", "Unknown resource or not allowed for this client")
+		return
+	}
+	if err != nil {
+		h.RespondInternalError(c, err, 20005)
+		return
+	}
+	audience, scope := resourceAccess(client, resource, scope)
+
+	// 2. Generate Access Token with the client as subject
+	accessToken, err := utils.GenerateAccessToken(client.PrivateKey, utils.AccessTokenClaims{
+		Issuer:   h.Config.Issuer,
+		Subject:  client.ID.String(),
+		ClientID: client.ID.String(),
+		Audience: audience,
+		Scope:    scope,
+		JKT:      req.Binding.JKT,
+		X5TS256:  req.Binding.X5TS256,
+	}, h.Config.AccessTokenExp)
+	if err != nil {
+		h.RespondInternalError(c, err, 3009)
 		return
 	}
 
-	// 5. Return Response
 	traceID, _ := c.Get(middleware.TraceIDKey)
-	slog.Info("Token exchanged", "client_id", client.ID, "user_id", data.UserID, "trace_id", traceID)
+	slog.Info("Client credentials token issued", "client_id", client.ID, "scope", scope, "trace_id", traceID)
 	c.JSON(http.StatusOK, gin.H{
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
-		"token_type":    "Bearer",
-		"expires_in":    h.Config.AccessTokenExp * 60,
+		"access_token": accessToken,
+		"token_type":   tokenType(req.Binding.JKT),
+		"expires_in":   h.Config.AccessTokenExp * 60,
+		"scope":        scope,
 	})
 }
 
+// refreshTokenGrant exchanges a refresh token issued to the authenticated client
+func (h *Handler) refreshTokenGrant(c *gin.Context, client *models.Client, req *TokenRequest) {
+	if req.RefreshToken == "" {
+		h.respondMissingTokenParameter(c, "refresh_token")
+		return
+	}
+
+	response, oauthErr := h.refreshTokens(c, client, req.RefreshToken, req.Scope, req.Resource, req.Binding)
+	if oauthErr != nil {
+		h.respondOAuthError(c, oauthErr)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// OAuthRefresh is the legacy JSON refresh endpoint. It does not authenticate the client
+// and keeps its original error responses.
 func (h *Handler) OAuthRefresh(c *gin.Context) {
-	// 1. Read Refresh Token from Body
 	var req RefreshRequest
 	if h.BindJSONWithValidation(c, &req) {
 		return
 	}
-	refreshToken := req.RefreshToken
 
-	// Check if blocked in Redis
-	key := "blocked_refresh_token:" + refreshToken
-	exists, err := h.RedisClient.Exists(context.Background(), key).Result()
-	if err != nil {
-		h.RespondInternalError(c, err, 3006)
-		return
+	jkt, oauthErr := h.checkDPoPProof(c, "")
+	var response gin.H
+	if oauthErr == nil {
+		response, oauthErr = h.refreshTokens(c, nil, req.RefreshToken, req.Scope, "", tokenBinding{JKT: jkt})
 	}
-	if exists > 0 {
-		h.RespondError(c, http.StatusUnauthorized, nil, "Refresh token is blocked")
+	if oauthErr != nil {
+		switch {
+		case oauthErr.internalCode != 0:
+			h.RespondInternalError(c, oauthErr.err, oauthErr.internalCode)
+		case oauthErr.code == "invalid_scope":
+			h.RespondError(c, http.StatusBadRequest, oauthErr.err, "invalid_scope")
+		default:
+			h.RespondError(c, http.StatusUnauthorized, oauthErr.err, oauthErr.description)
+		}
 		return
 	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+// refreshTokens rotates the refresh token and issues a new access token with the given binding.
+// When client is nil the client is taken from the token's audience, as the legacy endpoint does.
+func (h *Handler) refreshTokens(c *gin.Context, client *models.Client, refreshToken, requestedScope, requestedResource string, binding tokenBinding) (gin.H, *oauthError) {
+	invalidGrant := func(err error, description string) *oauthError {
+		return &oauthError{status: http.StatusBadRequest, code: "invalid_grant", description: description, err: err}
+	}
+
+	// 1. Check if blocked in Redis
+	blocked, err := h.isRefreshTokenBlocked(context.Background(), refreshToken)
+	if err != nil {
+		return nil, &oauthError{err: err, internalCode: 3006}
+	}
+	if blocked {
+		return nil, invalidGrant(nil, "Refresh token is blocked")
+	}
 
 	// 2. Validate Refresh Token
 	token, claims, err := utils.ValidateRefreshToken(refreshToken, h.Config.JWTSecret)
 	if err != nil || !token.Valid {
-		h.RespondError(c, http.StatusUnauthorized, err, "Invalid refresh token")
-		return
+		return nil, invalidGrant(err, "Invalid refresh token")
 	}
 
-	userID, ok := claims["sub"].(string)
+	subject, ok := claims["sub"].(string)
 	if !ok {
-		h.RespondError(c, http.StatusUnauthorized, nil, "Invalid token claims: sub")
-		return
+		return nil, invalidGrant(nil, "Invalid token claims: sub")
 	}
 	clientID, ok := claims["aud"].(string)
 	if !ok {
-		h.RespondError(c, http.StatusUnauthorized, nil, "Invalid token claims: aud")
-		return
+		return nil, invalidGrant(nil, "Invalid token claims: aud")
 	}
 
-	// 3. Get Client to get Private Key
-	var client models.Client
-	if err := h.DB.Where("id = ?", clientID).First(&client).Error; err != nil {
-		h.RespondError(c, http.StatusUnauthorized, err, "Client not found")
-		return
+	// 3. Get Client to get Private Key. An authenticated client may only use its own refresh tokens.
+	if client == nil {
+		client = &models.Client{}
+		if err := h.DB.Where("id = ?", clientID).First(client).Error; err != nil {
+			return nil, invalidGrant(err, "Client not found")
+		}
+		// The legacy endpoint does not authenticate the client, which only the legacy default method allows
+		if client.TokenEndpointAuthMethod != authMethodSecretBasic {
+			return nil, &oauthError{status: http.StatusBadRequest, code: "unauthorized_client", description: "Client must authenticate at the token endpoint to refresh tokens"}
+		}
+		x5t, oauthErr := h.certificateBinding(c, client)
+		if oauthErr != nil {
+			return nil, oauthErr
+		}
+		binding.X5TS256 = x5t
+	} else if client.ID.String() != clientID {
+		return nil, invalidGrant(nil, "Refresh token was not issued to this client")
+	}
+	if !client.AllowsGrantType("refresh_token") {
+		return nil, &oauthError{status: http.StatusBadRequest, code: "unauthorized_client", description: "Client is not allowed to use grant type refresh_token"}
+	}
+	userID, err := h.subjectUserID(c, client, subject)
+	if errors.Is(err, errUnknownSubject) {
+		return nil, invalidGrant(err, "Invalid token claims: sub")
+	}
+	if err != nil {
+		return nil, &oauthError{err: err, internalCode: 22001}
+	}
+
+	// 4. Downscope: the caller may ask for a subset of the originally granted scope
+	grantedScope, _ := claims["scope"].(string)
+	scope := grantedScope
+	if requestedScope != "" {
+		if !utils.ScopeSubset(requestedScope, grantedScope) {
+			return nil, &oauthError{status: http.StatusBadRequest, code: "invalid_scope", description: "Requested scope exceeds the granted scope"}
+		}
+		scope = requestedScope
 	}
 
-	// 4. Create New Access Token
-	accessToken, err := utils.GenerateAccessToken(client.PrivateKey, userID, clientID, h.Config.AccessTokenExp)
+	// The access token is for the resource of the original grant, or one the client may use when the grant had none
+	authorizedResource, _ := claims["resource"].(string)
+	resourceID, ok := grantedResource(authorizedResource, requestedResource)
+	if !ok {
+		return nil, &oauthError{status: http.StatusBadRequest, code: "invalid_target", description: "resource does not match the original grant"}
+	}
+	resource, err := h.lookupResource(c, client, resourceID)
+	if errors.Is(err, errInvalidTarget) {
+		return nil, &oauthError{status: http.StatusBadRequest, code: "invalid_target", description: "Unknown resource or not allowed for this client", err: err}
+	}
 	if err != nil {
-		h.RespondInternalError(c, err, 3005)
-		return
+		return nil, &oauthError{err: err, internalCode: 20006}
+	}
+	audience, accessScope := resourceAccess(client, resource, scope)
+
+	// 5. A DPoP-bound refresh token can only be used with a proof of the same key
+	if boundJKT := utils.ConfirmationJKT(claims); boundJKT != "" && boundJKT != binding.JKT {
+		return nil, &oauthError{status: http.StatusBadRequest, code: "invalid_dpop_proof", description: "Refresh token is bound to a different DPoP key"}
+	}
+
+	// 6. Create New Access Token, before rotating so a signing failure does not burn the refresh token
+	accessToken, err := utils.GenerateAccessToken(client.PrivateKey, utils.AccessTokenClaims{
+		Issuer:   h.Config.Issuer,
+		Subject:  subject,
+		ClientID: clientID,
+		Audience: audience,
+		Scope:    accessScope,
+		JKT:      binding.JKT,
+		X5TS256:  binding.X5TS256,
+		AuthTime: refreshAuthTime(claims),
+	}, h.Config.AccessTokenExp)
+	if err != nil {
+		return nil, &oauthError{err: err, internalCode: 3005}
+	}
+
+	// 7. Rotate Refresh Token. A token that was already rotated means it was stolen: its family is revoked.
+	newRefreshToken, err := h.rotateRefreshToken(context.Background(), userID, refreshToken, claims)
+	if errors.Is(err, errRefreshTokenReused) {
+		traceID, _ := c.Get(middleware.TraceIDKey)
+		slog.Warn("Refresh token reuse detected, token family revoked", "client_id", clientID, "user_id", userID, "family_id", claims["fid"], "trace_id", traceID)
+		return nil, invalidGrant(err, "Invalid refresh token")
+	}
+	if errors.Is(err, errRefreshFamilyRevoked) {
+		return nil, invalidGrant(err, "Invalid refresh token")
+	}
+	if err != nil {
+		return nil, &oauthError{err: err, internalCode: 3010}
+	}
+	// The sign-in is remembered for as long as the new refresh token lives
+	if err := h.recordSignedInClient(c, userID, clientID); err != nil {
+		return nil, &oauthError{err: err, internalCode: 3013}
 	}
 
 	traceID, _ := c.Get(middleware.TraceIDKey)
 	slog.Info("Token refreshed", "client_id", client.ID, "user_id", userID, "trace_id", traceID)
-	c.JSON(http.StatusOK, gin.H{
-		"access_token": accessToken,
-		"token_type":   "Bearer",
-		"expires_in":   h.Config.AccessTokenExp * 60,
-	})
+	return gin.H{
+		"access_token":  accessToken,
+		"refresh_token": newRefreshToken,
+		"token_type":    tokenType(binding.JKT),
+		"expires_in":    h.Config.AccessTokenExp * 60,
+		"scope":         accessScope,
+	}, nil
 }
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"auth-system/internal/middleware"
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	requestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+	// Long enough for the user to sign in and consent, as the login form refers to the pushed request
+	pushedRequestExpiry = 5 * time.Minute
+)
+
+// pushedRequest is what a request_uri refers to. Whether the request was pushed or signed is decided by the
+// server and stored next to the authorization parameters, never among them.
+type pushedRequest struct {
+	Request AuthorizeRequest `json:"request"`
+	Pushed  bool             `json:"pushed"`
+	Signed  bool             `json:"signed"`
+}
+
+// PushedAuthorizationRequest implements RFC 9126: the client sends the authorization parameters
+// back-channel and receives a request_uri to use at the authorization endpoint instead
+func (h *Handler) PushedAuthorizationRequest(c *gin.Context) {
+	// RFC 9126 Section 2.1: the parameters are sent form-encoded, like those of the authorization endpoint
+	if c.ContentType() != binding.MIMEPOSTForm {
+		h.RespondOAuthError(c, http.StatusBadRequest, nil, "invalid_request", "Content-Type must be application/x-www-form-urlencoded")
+		return
+	}
+
+	// 1. Authenticate Client
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	// 2. Read Request
+	var req AuthorizeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		h.RespondOAuthError(c, http.StatusBadRequest, err, "invalid_request", "Invalid request body")
+		return
+	}
+	if req.RequestURI != "" {
+		h.RespondOAuthError(c, http.StatusBadRequest, nil, "invalid_request", "request_uri is not allowed in a pushed authorization request")
+		return
+	}
+	if req.ClientID == "" {
+		req.ClientID = client.ID.String()
+	}
+	if req.ClientID != client.ID.String() {
+		h.RespondOAuthError(c, http.StatusBadRequest, nil, "invalid_request", "client_id does not match the authenticated client")
+		return
+	}
+
+	// 3. A pushed request may itself be a signed request object
+	if req.Request != "" {
+		if authErr := h.applyRequestObject(c, client, &req); authErr != nil {
+			if authErr.internalCode != 0 {
+				h.RespondInternalError(c, authErr.err, authErr.internalCode)
+				return
+			}
+			h.RespondOAuthError(c, http.StatusBadRequest, authErr.err, authErr.code, authErr.description)
+			return
+		}
+	}
+	if client.RequireSignedRequestObject && !req.Signed {
+		h.RespondOAuthError(c, http.StatusBadRequest, nil, "invalid_request", "This client must use signed request objects")
+		return
+	}
+
+	// 4. Validate exactly as the authorization endpoint will. Errors are returned directly, never redirected.
+	if _, authErr := h.validateAuthorizeRequest(c, &req); authErr != nil {
+		if authErr.internalCode != 0 {
+			h.RespondInternalError(c, authErr.err, authErr.internalCode)
+			return
+		}
+		h.RespondOAuthError(c, http.StatusBadRequest, nil, authErr.code, authErr.description)
+		return
+	}
+
+	// 5. Store the Request
+	req.Pushed = true
+	requestURI, err := h.savePushedRequest(c, &req)
+	if err != nil {
+		h.RespondInternalError(c, err, 13001)
+		return
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("Authorization request pushed", "client_id", client.ID, "trace_id", traceID)
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, gin.H{
+		"request_uri": requestURI,
+		"expires_in":  int(pushedRequestExpiry.Seconds()),
+	})
+}
+
+// pushedRequestKey is the Redis key of a pushed request.
+// Key format: par:{id}
+func pushedRequestKey(requestURI string) string {
+	return "par:" + strings.TrimPrefix(requestURI, requestURIPrefix)
+}
+
+// savePushedRequest stores the resolved authorization parameters and returns the request_uri referring to them
+func (h *Handler) savePushedRequest(ctx context.Context, req *AuthorizeRequest) (string, error) {
+	id, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	jsonData, err := json.Marshal(pushedRequest{Request: *req, Pushed: req.Pushed, Signed: req.Signed})
+	if err != nil {
+		return "", err
+	}
+
+	requestURI := requestURIPrefix + id
+	return requestURI, h.RedisClient.Set(ctx, pushedRequestKey(requestURI), jsonData, pushedRequestExpiry).Err()
+}
+
+// resolveAuthorizeRequest replaces the parameters of a request referring to a pushed request with the
+// pushed ones, or with those of a signed request object, then validates it. A verified request object is
+// stored like a pushed request, so the login form only carries its reference and its jti is spent once.
+// Clients that must use PAR or signed request objects are refused any other request.
+func (h *Handler) resolveAuthorizeRequest(c *gin.Context, req *AuthorizeRequest) (*models.Client, *authorizeError) {
+	switch {
+	case strings.HasPrefix(req.RequestURI, requestURIPrefix):
+		val, err := h.RedisClient.Get(c, pushedRequestKey(req.RequestURI)).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil, &authorizeError{code: "invalid_request_uri", description: "request_uri is invalid or expired"}
+		}
+		if err != nil {
+			return nil, &authorizeError{err: err, internalCode: 13004}
+		}
+
+		var pushed pushedRequest
+		if err := json.Unmarshal([]byte(val), &pushed); err != nil {
+			return nil, &authorizeError{err: err, internalCode: 13005}
+		}
+		if pushed.Request.ClientID != req.ClientID {
+			return nil, &authorizeError{code: "invalid_request", description: "client_id does not match the pushed authorization request"}
+		}
+
+		requestURI := req.RequestURI
+		*req = pushed.Request
+		req.RequestURI = requestURI
+		req.Pushed, req.Signed = pushed.Pushed, pushed.Signed
+
+	case req.RequestURI != "" || req.Request != "":
+		if req.RequestURI != "" && req.Request != "" {
+			return nil, &authorizeError{code: "invalid_request", description: "request and request_uri cannot be used together"}
+		}
+		if req.ClientID == "" {
+			return nil, &authorizeError{code: "invalid_request", description: "client_id is required"}
+		}
+		var client models.Client
+		if err := h.DB.Where("id = ?", req.ClientID).First(&client).Error; err != nil {
+			return nil, &authorizeError{code: "invalid_client", description: "Unknown client"}
+		}
+
+		if req.RequestURI != "" {
+			requestObject, authErr := h.fetchRequestObject(&client, req.RequestURI)
+			if authErr != nil {
+				return nil, authErr
+			}
+			req.Request = requestObject
+		}
+		if authErr := h.applyRequestObject(c, &client, req); authErr != nil {
+			return nil, authErr
+		}
+
+		requestURI, err := h.savePushedRequest(c, req)
+		if err != nil {
+			return nil, &authorizeError{err: err, internalCode: 19002}
+		}
+		req.RequestURI = requestURI
+	}
+
+	client, authErr := h.validateAuthorizeRequest(c, req)
+	if authErr != nil {
+		return nil, authErr
+	}
+	if client.RequirePushedAuthorizationRequests && !req.Pushed {
+		return nil, &authorizeError{redirect: true, code: "invalid_request", description: "This client must use pushed authorization requests"}
+	}
+	if client.RequireSignedRequestObject && !req.Signed {
+		return nil, &authorizeError{redirect: true, code: "invalid_request", description: "This client must use signed request objects"}
+	}
+
+	return client, nil
+}
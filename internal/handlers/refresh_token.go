@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"auth-system/internal/utils"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Refresh tokens are rotated on every use. All tokens rotated from the same grant form a family,
+// and Redis only remembers the jti of the family's current token:
+// Key format: refresh_family:{family_id} -> current jti
+// Each user's families are indexed so they can be revoked per client:
+// Key format: user_refresh_families:{user_id} -> hash of family_id -> client_id
+
+var (
+	errRefreshFamilyRevoked = errors.New("refresh token family revoked or expired")
+	errRefreshTokenReused   = errors.New("refresh token reuse detected")
+)
+
+// rotateRefreshFamilyScript atomically swaps the family's current jti and keeps the user's index alive as long as the family.
+// Returns 1 on success, 0 when the family no longer exists and -1 when the presented jti is stale,
+// in which case the whole family is revoked.
+var rotateRefreshFamilyScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if not current then
+	return 0
+end
+if current ~= ARGV[1] then
+	redis.call('DEL', KEYS[1])
+	return -1
+end
+redis.call('SET', KEYS[1], ARGV[2], 'EX', ARGV[3])
+redis.call('HSET', KEYS[2], ARGV[4], ARGV[5])
+redis.call('EXPIRE', KEYS[2], ARGV[3])
+return 1
+`)
+
+func refreshFamilyKey(familyID string) string {
+	return "refresh_family:" + familyID
+}
+
+func userRefreshFamiliesKey(userID string) string {
+	return "user_refresh_families:" + userID
+}
+
+func (h *Handler) refreshTokenTTL() time.Duration {
+	return time.Duration(h.Config.RefreshTokenExp) * 24 * time.Hour
+}
+
+// issueRefreshToken generates a refresh token with the given claims starting a new family, indexed under the user.
+// The subject of the claims is the sub the client knows the user by.
+func (h *Handler) issueRefreshToken(ctx context.Context, userID string, claims utils.RefreshTokenClaims) (string, error) {
+	claims.FamilyID = uuid.New().String()
+	claims.JTI = uuid.New().String()
+
+	refreshToken, err := utils.GenerateRefreshToken(h.Config.JWTSecret, claims, h.Config.RefreshTokenExp)
+	if err != nil {
+		return "", err
+	}
+
+	indexKey := userRefreshFamiliesKey(userID)
+	pipe := h.RedisClient.TxPipeline()
+	pipe.Set(ctx, refreshFamilyKey(claims.FamilyID), claims.JTI, h.refreshTokenTTL())
+	pipe.HSet(ctx, indexKey, claims.FamilyID, claims.ClientID)
+	pipe.Expire(ctx, indexKey, h.refreshTokenTTL())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+// rotateRefreshToken invalidates the presented refresh token and returns its successor in the same family.
+// Presenting a token that was already rotated revokes the whole family and returns errRefreshTokenReused.
+func (h *Handler) rotateRefreshToken(ctx context.Context, userID, refreshToken string, claims jwt.MapClaims) (string, error) {
+	subject, _ := claims["sub"].(string)
+	clientID, _ := claims["aud"].(string)
+	jti, _ := claims["jti"].(string)
+	familyID, _ := claims["fid"].(string)
+	scope, _ := claims["scope"].(string)
+	resource, _ := claims["resource"].(string)
+	jkt := utils.ConfirmationJKT(claims)
+	authTime := refreshAuthTime(claims)
+
+	// Tokens issued before rotation existed have no family: block them and start one
+	if familyID == "" || jti == "" {
+		if _, err := h.blockRefreshToken(ctx, refreshToken, claims); err != nil {
+			return "", err
+		}
+		return h.issueRefreshToken(ctx, userID, utils.RefreshTokenClaims{
+			Subject:  subject,
+			ClientID: clientID,
+			Scope:    scope,
+			Resource: resource,
+			JKT:      jkt,
+			AuthTime: authTime,
+		})
+	}
+
+	newJTI := uuid.New().String()
+	result, err := rotateRefreshFamilyScript.Run(ctx, h.RedisClient, []string{refreshFamilyKey(familyID), userRefreshFamiliesKey(userID)},
+		jti, newJTI, int(h.refreshTokenTTL().Seconds()), familyID, clientID).Int()
+	if err != nil {
+		return "", err
+	}
+	switch result {
+	case 0:
+		return "", errRefreshFamilyRevoked
+	case -1:
+		return "", errRefreshTokenReused
+	}
+
+	// The successor keeps the scope, resource, DPoP binding and authentication time of the original grant,
+	// even when the caller downscoped the access token
+	return utils.GenerateRefreshToken(h.Config.JWTSecret, utils.RefreshTokenClaims{
+		Subject:  subject,
+		ClientID: clientID,
+		JTI:      newJTI,
+		FamilyID: familyID,
+		Scope:    scope,
+		Resource: resource,
+		JKT:      jkt,
+		AuthTime: authTime,
+	}, h.Config.RefreshTokenExp)
+}
+
+// refreshAuthTime returns when the user authenticated for the grant of the refresh token, or 0 for
+// tokens issued before it was recorded
+func refreshAuthTime(claims jwt.MapClaims) int64 {
+	authTime, _ := claims["auth_time"].(float64)
+	return int64(authTime)
+}
+
+// isRefreshTokenCurrent reports whether the refresh token is still the current token of its family
+func (h *Handler) isRefreshTokenCurrent(ctx context.Context, claims jwt.MapClaims) (bool, error) {
+	familyID, _ := claims["fid"].(string)
+	if familyID == "" {
+		// Tokens issued before rotation existed are only subject to blocking
+		return true, nil
+	}
+
+	current, err := h.RedisClient.Get(ctx, refreshFamilyKey(familyID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return current == claims["jti"], nil
+}
+
+// revokeRefreshFamily invalidates every refresh token rotated from the same grant
+func (h *Handler) revokeRefreshFamily(ctx context.Context, claims jwt.MapClaims) error {
+	familyID, _ := claims["fid"].(string)
+	if familyID == "" {
+		return nil
+	}
+	return h.RedisClient.Del(ctx, refreshFamilyKey(familyID)).Err()
+}
+
+// revokeUserRefreshTokens revokes every refresh token family the user holds for the client,
+// or for all clients when clientID is empty
+func (h *Handler) revokeUserRefreshTokens(ctx context.Context, userID, clientID string) error {
+	indexKey := userRefreshFamiliesKey(userID)
+	families, err := h.RedisClient.HGetAll(ctx, indexKey).Result()
+	if err != nil {
+		return err
+	}
+
+	var familyIDs, familyKeys []string
+	for familyID, familyClientID := range families {
+		if clientID == "" || familyClientID == clientID {
+			familyIDs = append(familyIDs, familyID)
+			familyKeys = append(familyKeys, refreshFamilyKey(familyID))
+		}
+	}
+	if len(familyIDs) == 0 {
+		return nil
+	}
+
+	pipe := h.RedisClient.TxPipeline()
+	pipe.Del(ctx, familyKeys...)
+	pipe.HDel(ctx, indexKey, familyIDs...)
+	_, err = pipe.Exec(ctx)
+	return err
+}
@@ -4,8 +4,10 @@ import (
 	"auth-system/internal/middleware"
 	"auth-system/internal/models"
 	"auth-system/internal/utils"
+	"encoding/json"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"regexp"
 	"time"
 
@@ -13,6 +15,9 @@ import (
 	"github.com/google/uuid"
 )
 
+// defaultClientScopes are granted to clients registered without an explicit scope
+const defaultClientScopes = "openid profile email"
+
 type UserRegisterRequest struct {
 	FirstName string `json:"first_name" binding:"required"`
 	LastName  string `json:"last_name" binding:"required"`
@@ -21,7 +26,21 @@ type UserRegisterRequest struct {
 }
 
 type ClientRegisterRequest struct {
-	Name string `json:"name" binding:"required"`
+	Name                    string          `json:"name" binding:"required"`
+	RedirectURIs            []string        `json:"redirect_uris"`
+	Scope                   string          `json:"scope"`
+	TokenEndpointAuthMethod string          `json:"token_endpoint_auth_method" binding:"omitempty,oneof=client_secret_basic client_secret_post private_key_jwt tls_client_auth self_signed_tls_client_auth"`
+	JWKS                    json.RawMessage `json:"jwks"`
+	RequirePAR              bool            `json:"require_pushed_authorization_requests"`
+	TLSSubjectDN            string          `json:"tls_client_auth_subject_dn"`
+	CertificateBoundTokens  bool            `json:"tls_client_certificate_bound_access_tokens"`
+	TokenExchangeAudiences  []string        `json:"token_exchange_audiences"`
+	PostLogoutRedirectURIs  []string        `json:"post_logout_redirect_uris"`
+	BackchannelLogoutURI    string          `json:"backchannel_logout_uri"`
+	RequestURIs             []string        `json:"request_uris"`
+	RequireSignedRequest    bool            `json:"require_signed_request_object"`
+	AllowedResources        []string        `json:"allowed_resources"`
+	SubjectType             string          `json:"subject_type"`
 }
 
 func (h *Handler) RegisterUser(c *gin.Context) {
@@ -141,6 +160,12 @@ func (h *Handler) RegisterClient(c *gin.Context) {
 		validationErrors = make(map[string]any)
 	}
 
+	// Token exchange audiences and allowed resources grant access beyond the client itself, so like
+	// PATCH /clients/:client_id/policy they require the initial access token. Registrations without them stay open.
+	if (len(req.TokenExchangeAudiences) > 0 || len(req.AllowedResources) > 0) && !h.authenticateInitialAccessToken(c) {
+		return
+	}
+
 	// Check name unique
 	if req.Name != "" {
 		var count int64
@@ -150,6 +175,33 @@ func (h *Handler) RegisterClient(c *gin.Context) {
 		}
 	}
 
+	MergeErrors(validationErrors, validateRedirectURIs(req.RedirectURIs))
+	if err := utils.ValidateScope(req.Scope); err != nil {
+		MergeErrors(validationErrors, map[string]any{"scope": err.Error()})
+	}
+	if req.TokenEndpointAuthMethod == "" {
+		req.TokenEndpointAuthMethod = authMethodSecretBasic
+	}
+	MergeErrors(validationErrors, validateClientAuthentication(req.TokenEndpointAuthMethod, jwksParam(req.JWKS), req.TLSSubjectDN))
+	audienceErrors, err := h.validateTokenExchangeAudiences(req.TokenExchangeAudiences)
+	if err != nil {
+		h.RespondInternalError(c, err, 1009)
+		return
+	}
+	MergeErrors(validationErrors, audienceErrors)
+	MergeErrors(validationErrors, validateLogoutURIs(req.PostLogoutRedirectURIs, req.BackchannelLogoutURI))
+	MergeErrors(validationErrors, validateRequestObjectSettings(req.RequestURIs, req.RequireSignedRequest, jwksParam(req.JWKS)))
+	resourceErrors, err := h.validateAllowedResources(req.AllowedResources)
+	if err != nil {
+		h.RespondInternalError(c, err, 1010)
+		return
+	}
+	MergeErrors(validationErrors, resourceErrors)
+	if req.SubjectType == "" {
+		req.SubjectType = subjectTypePublic
+	}
+	MergeErrors(validationErrors, h.validateSubjectType(req.SubjectType))
+
 	if len(validationErrors) > 0 {
 		h.RespondValidationError(c, validationErrors)
 		return
@@ -177,10 +229,28 @@ func (h *Handler) RegisterClient(c *gin.Context) {
 	}
 
 	client := models.Client{
-		Name:       req.Name,
-		Secret:     hashedSecret,
-		PrivateKey: privKey,
-		PublicKey:  pubKey,
+		Name:                    req.Name,
+		Secret:                  hashedSecret,
+		PrivateKey:              privKey,
+		PublicKey:               pubKey,
+		RedirectURIs:            req.RedirectURIs,
+		Scopes:                  req.Scope,
+		TokenEndpointAuthMethod: req.TokenEndpointAuthMethod,
+		JWKS:                    jwksParam(req.JWKS),
+
+		RequirePushedAuthorizationRequests:    req.RequirePAR,
+		TLSClientAuthSubjectDN:                req.TLSSubjectDN,
+		TLSClientCertificateBoundAccessTokens: req.CertificateBoundTokens,
+		TokenExchangeAudiences:                req.TokenExchangeAudiences,
+		PostLogoutRedirectURIs:                req.PostLogoutRedirectURIs,
+		BackchannelLogoutURI:                  req.BackchannelLogoutURI,
+		RequestURIs:                           req.RequestURIs,
+		RequireSignedRequestObject:            req.RequireSignedRequest,
+		AllowedResources:                      req.AllowedResources,
+		SubjectType:                           req.SubjectType,
+	}
+	if client.Scopes == "" {
+		client.Scopes = defaultClientScopes
 	}
 
 	if err := h.DB.Create(&client).Error; err != nil {
@@ -189,19 +259,47 @@ func (h *Handler) RegisterClient(c *gin.Context) {
 	}
 
 	response := struct {
-		ID        uuid.UUID `json:"id"`
-		Name      string    `json:"name"`
-		Secret    string    `json:"secret"`
-		PublicKey string    `json:"public_key"`
-		CreatedAt time.Time `json:"created_at"`
-		UpdatedAt time.Time `json:"updated_at"`
+		ID                      uuid.UUID       `json:"id"`
+		Name                    string          `json:"name"`
+		Secret                  string          `json:"secret"`
+		PublicKey               string          `json:"public_key"`
+		RedirectURIs            []string        `json:"redirect_uris"`
+		Scope                   string          `json:"scope"`
+		TokenEndpointAuthMethod string          `json:"token_endpoint_auth_method"`
+		JWKS                    json.RawMessage `json:"jwks,omitempty"`
+		RequirePAR              bool            `json:"require_pushed_authorization_requests"`
+		TLSSubjectDN            string          `json:"tls_client_auth_subject_dn,omitempty"`
+		CertificateBoundTokens  bool            `json:"tls_client_certificate_bound_access_tokens"`
+		TokenExchangeAudiences  []string        `json:"token_exchange_audiences,omitempty"`
+		PostLogoutRedirectURIs  []string        `json:"post_logout_redirect_uris,omitempty"`
+		BackchannelLogoutURI    string          `json:"backchannel_logout_uri,omitempty"`
+		RequestURIs             []string        `json:"request_uris,omitempty"`
+		RequireSignedRequest    bool            `json:"require_signed_request_object"`
+		AllowedResources        []string        `json:"allowed_resources,omitempty"`
+		SubjectType             string          `json:"subject_type"`
+		CreatedAt               time.Time       `json:"created_at"`
+		UpdatedAt               time.Time       `json:"updated_at"`
 	}{
-		ID:        client.ID,
-		Name:      client.Name,
-		Secret:    secret, // Return PLAIN secret once
-		PublicKey: client.PublicKey,
-		CreatedAt: client.CreatedAt,
-		UpdatedAt: client.UpdatedAt,
+		ID:                      client.ID,
+		Name:                    client.Name,
+		Secret:                  secret, // Return PLAIN secret once
+		PublicKey:               client.PublicKey,
+		RedirectURIs:            client.RedirectURIs,
+		Scope:                   client.Scopes,
+		TokenEndpointAuthMethod: client.TokenEndpointAuthMethod,
+		JWKS:                    clientJWKS(&client),
+		RequirePAR:              client.RequirePushedAuthorizationRequests,
+		TLSSubjectDN:            client.TLSClientAuthSubjectDN,
+		CertificateBoundTokens:  client.TLSClientCertificateBoundAccessTokens,
+		TokenExchangeAudiences:  client.TokenExchangeAudiences,
+		PostLogoutRedirectURIs:  client.PostLogoutRedirectURIs,
+		BackchannelLogoutURI:    client.BackchannelLogoutURI,
+		RequestURIs:             client.RequestURIs,
+		RequireSignedRequest:    client.RequireSignedRequestObject,
+		AllowedResources:        client.AllowedResources,
+		SubjectType:             client.SubjectType,
+		CreatedAt:               client.CreatedAt,
+		UpdatedAt:               client.UpdatedAt,
 	}
 
 	traceID, _ := c.Get(middleware.TraceIDKey)
@@ -209,6 +307,105 @@ func (h *Handler) RegisterClient(c *gin.Context) {
 	c.JSON(http.StatusCreated, response)
 }
 
+func validateRedirectURIs(uris []string) map[string]any {
+	var errors []string
+	for _, uri := range uris {
+		if err := utils.ValidateRedirectURI(uri); err != nil {
+			errors = append(errors, uri+": "+err.Error())
+		}
+	}
+	if len(errors) > 0 {
+		return map[string]any{"redirect_uris": errors}
+	}
+	return nil
+}
+
+// validateLogoutURIs checks the post-logout redirect URIs like redirect URIs. The back-channel
+// logout URI is called by the server, so it must be an http(s) URL without a fragment.
+func validateLogoutURIs(postLogoutRedirectURIs []string, backchannelLogoutURI string) map[string]any {
+	var errors []string
+	for _, uri := range postLogoutRedirectURIs {
+		if err := utils.ValidateRedirectURI(uri); err != nil {
+			errors = append(errors, uri+": "+err.Error())
+		}
+	}
+	if len(errors) > 0 {
+		return map[string]any{"post_logout_redirect_uris": errors}
+	}
+
+	// The server calls the back-channel logout URI itself, so it must not point into the server's network
+	if backchannelLogoutURI != "" {
+		if err := utils.ValidateExternalURL(backchannelLogoutURI); err != nil {
+			return map[string]any{"backchannel_logout_uri": err.Error()}
+		}
+		if u, _ := url.Parse(backchannelLogoutURI); u.Fragment != "" {
+			return map[string]any{"backchannel_logout_uri": "must not contain a fragment"}
+		}
+	}
+	return nil
+}
+
+// validateRequestObjectSettings checks that request_uris are external https URLs the server can fetch,
+// and that a client requiring signed request objects has keys to sign them with
+func validateRequestObjectSettings(requestURIs []string, requireSigned bool, jwks string) map[string]any {
+	for _, uri := range requestURIs {
+		if err := utils.ValidateExternalURL(uri); err != nil {
+			return map[string]any{"request_uris": uri + ": " + err.Error()}
+		}
+	}
+	if requireSigned && jwks == "" {
+		return map[string]any{"jwks": "Required for signed request objects"}
+	}
+	return nil
+}
+
+// validateTokenExchangeAudiences checks that every audience a client may exchange tokens into is a registered client
+func (h *Handler) validateTokenExchangeAudiences(audiences []string) (map[string]any, error) {
+	for _, audience := range audiences {
+		var count int64
+		if id, err := uuid.Parse(audience); err == nil {
+			if err := h.DB.Model(&models.Client{}).Where("id = ?", id).Count(&count).Error; err != nil {
+				return nil, err
+			}
+		}
+		if count == 0 {
+			return map[string]any{"token_exchange_audiences": "Unknown client " + audience}, nil
+		}
+	}
+	return nil, nil
+}
+
+// validateClientAuthentication checks that the client has the key set or certificate subject its auth method needs
+func validateClientAuthentication(method, jwks, subjectDN string) map[string]any {
+	if jwks != "" {
+		if _, err := utils.ParseJWKS([]byte(jwks)); err != nil {
+			return map[string]any{"jwks": "Invalid JWKS: " + err.Error()}
+		}
+	} else if method == authMethodPrivateKeyJWT || method == authMethodSelfSignedTLSClientAuth {
+		return map[string]any{"jwks": "Required for " + method}
+	}
+	if method == authMethodTLSClientAuth && subjectDN == "" {
+		return map[string]any{"tls_client_auth_subject_dn": "Required for " + method}
+	}
+	return nil
+}
+
+// jwksParam returns the JWKS request parameter as stored on the client, empty when absent or null
+func jwksParam(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
+
+// clientJWKS returns the client's key set for responses, nil when it has none
+func clientJWKS(client *models.Client) json.RawMessage {
+	if client.JWKS == "" {
+		return nil
+	}
+	return json.RawMessage(client.JWKS)
+}
+
 func validatePassword(s string) []string {
 	var errors []string
 	if len(s) < 8 {
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// Request objects living longer than this are rejected, which also bounds how long their jti is remembered
+	maxRequestObjectLifetime = time.Hour
+	maxRequestObjectSize     = 64 << 10
+)
+
+var requestObjectClient = utils.NewExternalHTTPClient(5 * time.Second)
+
+// requestObjectParams maps the claims of a request object to the authorization parameters they override
+func requestObjectParams(req *AuthorizeRequest) map[string]*string {
+	return map[string]*string{
+		"response_type":         &req.ResponseType,
+		"redirect_uri":          &req.RedirectURI,
+		"state":                 &req.State,
+		"scope":                 &req.Scope,
+		"nonce":                 &req.Nonce,
+		"code_challenge":        &req.CodeChallenge,
+		"code_challenge_method": &req.CodeChallengeMethod,
+		"resource":              &req.Resource,
+		"prompt":                &req.Prompt,
+	}
+}
+
+// applyRequestObject verifies the RFC 9101 request object of the request, signed with one of the client's
+// registered keys, and replaces the authorization parameters with the signed ones
+func (h *Handler) applyRequestObject(ctx context.Context, client *models.Client, req *AuthorizeRequest) *authorizeError {
+	invalid := func(err error, description string) *authorizeError {
+		return &authorizeError{code: "invalid_request_object", description: description, err: err}
+	}
+
+	if client.JWKS == "" {
+		return invalid(nil, "Client has no registered JWKS")
+	}
+	jwks, err := utils.ParseJWKS([]byte(client.JWKS))
+	if err != nil {
+		return invalid(err, "Client has no usable JWKS")
+	}
+
+	// 1. Verify Signature and Claims (RFC 9101 Section 6.3)
+	claims, err := utils.ValidateRequestObject(req.Request, jwks)
+	if err != nil {
+		return invalid(err, "Invalid request object")
+	}
+	if iss, _ := claims["iss"].(string); iss != client.ID.String() {
+		return invalid(nil, "Request object iss must be the client_id")
+	}
+	if clientID, ok := claims["client_id"]; ok && clientID != req.ClientID {
+		return invalid(nil, "Request object client_id does not match the request")
+	}
+	if aud, err := claims.GetAudience(); err != nil || !slices.Contains(aud, h.Config.Issuer) {
+		return invalid(err, "Request object audience is not this server")
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return invalid(nil, "Request object jti is required")
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return invalid(err, "Invalid request object")
+	}
+	lifetime := time.Until(exp.Time)
+	if lifetime > maxRequestObjectLifetime {
+		return invalid(nil, "Request object expires too far in the future")
+	}
+
+	// 2. Prevent Replay
+	// Key format: request_object_jti:{client_id}:{jti}
+	fresh, err := h.RedisClient.SetNX(ctx, "request_object_jti:"+client.ID.String()+":"+jti, "used", lifetime).Result()
+	if err != nil {
+		return &authorizeError{err: err, internalCode: 19001}
+	}
+	if !fresh {
+		return invalid(nil, "Request object has already been used")
+	}
+
+	// 3. Only the signed values are used (RFC 9101 Section 6.3): plain parameters the object omits are dropped
+	for name, param := range requestObjectParams(req) {
+		*param, _ = claims[name].(string)
+	}
+	req.MaxAge = ""
+	if maxAge, ok := claims["max_age"].(float64); ok {
+		req.MaxAge = strconv.FormatFloat(maxAge, 'f', -1, 64)
+	}
+	req.Request = ""
+	req.Signed = true
+	return nil
+}
+
+// fetchRequestObject downloads a request object passed by reference. Only request_uris the client
+// registered are fetched, so the server cannot be made to request arbitrary URLs.
+func (h *Handler) fetchRequestObject(client *models.Client, requestURI string) (string, *authorizeError) {
+	if !slices.Contains(client.RequestURIs, requestURI) {
+		return "", &authorizeError{code: "invalid_request_uri", description: "request_uri is not registered for this client"}
+	}
+
+	resp, err := requestObjectClient.Get(requestURI)
+	if err != nil {
+		return "", &authorizeError{code: "invalid_request_uri", description: "request_uri could not be retrieved", err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &authorizeError{code: "invalid_request_uri", description: "request_uri could not be retrieved", err: fmt.Errorf("unexpected status %d", resp.StatusCode)}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRequestObjectSize+1))
+	if err != nil {
+		return "", &authorizeError{code: "invalid_request_uri", description: "request_uri could not be retrieved", err: err}
+	}
+	if len(body) > maxRequestObjectSize {
+		return "", &authorizeError{code: "invalid_request_uri", description: "request_uri could not be retrieved", err: errors.New("request object too large")}
+	}
+	return string(body), nil
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"auth-system/internal/middleware"
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type APIResourceRequest struct {
+	Identifier string `json:"identifier" binding:"required"`
+	Name       string `json:"name" binding:"required"`
+	Scope      string `json:"scope"`
+}
+
+// errInvalidTarget is returned for a resource parameter naming an unknown resource or one the client may not use
+var errInvalidTarget = errors.New("resource is unknown or not allowed for this client")
+
+// RegisterResource registers an API resource that clients can request access tokens for.
+// Like client registration it requires the initial access token configured on the server.
+func (h *Handler) RegisterResource(c *gin.Context) {
+	if !h.authenticateInitialAccessToken(c) {
+		return
+	}
+
+	var req APIResourceRequest
+	validationErrors, err := h.GetValidationErrors(c, &req)
+	if err != nil {
+		h.RespondError(c, http.StatusBadRequest, err, "Invalid JSON")
+		return
+	}
+	if validationErrors == nil {
+		validationErrors = make(map[string]any)
+	}
+
+	// RFC 8707 Section 2: an absolute URI without a fragment
+	if req.Identifier != "" {
+		if u, err := url.Parse(req.Identifier); err != nil || !u.IsAbs() || u.Fragment != "" {
+			MergeErrors(validationErrors, map[string]any{"identifier": "Must be an absolute URI without a fragment"})
+		} else {
+			var count int64
+			if err := h.DB.Model(&models.APIResource{}).Where("identifier = ?", req.Identifier).Count(&count).Error; err != nil {
+				h.RespondInternalError(c, err, 20009)
+				return
+			}
+			if count > 0 {
+				MergeErrors(validationErrors, map[string]any{"identifier": "Resource already registered"})
+			}
+		}
+	}
+	if err := utils.ValidateScope(req.Scope); err != nil {
+		MergeErrors(validationErrors, map[string]any{"scope": err.Error()})
+	}
+
+	if len(validationErrors) > 0 {
+		h.RespondValidationError(c, validationErrors)
+		return
+	}
+
+	resource := models.APIResource{
+		Identifier: req.Identifier,
+		Name:       req.Name,
+		Scopes:     req.Scope,
+	}
+	if err := h.DB.Create(&resource).Error; err != nil {
+		h.RespondInternalError(c, err, 20001)
+		return
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("API resource registered", "resource_id", resource.ID, "identifier", resource.Identifier, "trace_id", traceID)
+	c.JSON(http.StatusCreated, resourceDetails(&resource))
+}
+
+// ListResources returns every registered API resource
+func (h *Handler) ListResources(c *gin.Context) {
+	if !h.authenticateInitialAccessToken(c) {
+		return
+	}
+
+	var resources []models.APIResource
+	if err := h.DB.Order("created_at").Find(&resources).Error; err != nil {
+		h.RespondInternalError(c, err, 20002)
+		return
+	}
+
+	response := make([]gin.H, 0, len(resources))
+	for i := range resources {
+		response = append(response, resourceDetails(&resources[i]))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteResource removes an API resource. Tokens already issued for it stay valid until they expire.
+func (h *Handler) DeleteResource(c *gin.Context) {
+	if !h.authenticateInitialAccessToken(c) {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.RespondError(c, http.StatusNotFound, err, "Resource not found")
+		return
+	}
+
+	result := h.DB.Where("id = ?", id).Delete(&models.APIResource{})
+	if result.Error != nil {
+		h.RespondInternalError(c, result.Error, 20003)
+		return
+	}
+	if result.RowsAffected == 0 {
+		h.RespondError(c, http.StatusNotFound, nil, "Resource not found")
+		return
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("API resource deleted", "resource_id", id, "trace_id", traceID)
+	c.Status(http.StatusNoContent)
+}
+
+func resourceDetails(resource *models.APIResource) gin.H {
+	return gin.H{
+		"id":         resource.ID,
+		"identifier": resource.Identifier,
+		"name":       resource.Name,
+		"scope":      resource.Scopes,
+		"created_at": resource.CreatedAt,
+	}
+}
+
+// lookupResource returns the API resource named by a resource parameter, or nil when none was given.
+// It returns errInvalidTarget when the resource is unknown or the client is not allowed to use it.
+func (h *Handler) lookupResource(ctx context.Context, client *models.Client, identifier string) (*models.APIResource, error) {
+	if identifier == "" {
+		return nil, nil
+	}
+	if !slices.Contains(client.AllowedResources, identifier) {
+		return nil, errInvalidTarget
+	}
+
+	var resource models.APIResource
+	err := h.DB.WithContext(ctx).Where("identifier = ?", identifier).First(&resource).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvalidTarget
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &resource, nil
+}
+
+// resourceAccess returns the audience and scope of an access token for the resource. Tokens for a resource
+// only carry the granted scopes it understands; without a resource they are addressed to the client itself.
+func resourceAccess(client *models.Client, resource *models.APIResource, scope string) (string, string) {
+	if resource == nil {
+		return client.ID.String(), scope
+	}
+	return resource.Identifier, utils.FilterScope(scope, resource.Scopes)
+}
+
+// grantedResource resolves the resource of a token request against the one authorized with the grant.
+// A grant authorized for a resource can only be used for that resource.
+func grantedResource(authorized, requested string) (string, bool) {
+	if authorized == "" {
+		return requested, true
+	}
+	return authorized, requested == "" || requested == authorized
+}
+
+// validateAllowedResources checks that every resource a client may use is registered
+func (h *Handler) validateAllowedResources(identifiers []string) (map[string]any, error) {
+	for _, identifier := range identifiers {
+		var count int64
+		if err := h.DB.Model(&models.APIResource{}).Where("identifier = ?", identifier).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return map[string]any{"allowed_resources": "Unknown resource " + identifier}, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"auth-system/internal/middleware"
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RevokeRequest struct {
+	Token         string `form:"token" json:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint" json:"token_type_hint"`
+}
+
+var errTokenNotOwned = errors.New("token was not issued to this client")
+
+// Revoke implements RFC 7009 token revocation for access and refresh tokens.
+// Invalid or unknown tokens are not an error and still return 200.
+func (h *Handler) Revoke(c *gin.Context) {
+	// 1. Authenticate Client
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	// 2. Read Request
+	var req RevokeRequest
+	if h.BindFormWithValidation(c, &req) {
+		return
+	}
+
+	// 3. Try the hinted token type first, then fall back to the other one
+	revokers := []func(*gin.Context, *models.Client, string) (bool, error){h.revokeAccessToken, h.revokeRefreshToken}
+	if req.TokenTypeHint == "refresh_token" {
+		revokers[0], revokers[1] = revokers[1], revokers[0]
+	}
+
+	for _, revoke := range revokers {
+		revoked, err := revoke(c, client, req.Token)
+		if errors.Is(err, errTokenNotOwned) {
+			h.RespondOAuthError(c, http.StatusBadRequest, err, "unauthorized_client", "Token was not issued to this client")
+			return
+		}
+		if err != nil {
+			h.RespondInternalError(c, err, 9001)
+			return
+		}
+		if revoked {
+			break
+		}
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("Token revocation requested", "client_id", client.ID, "trace_id", traceID)
+	c.Status(http.StatusOK)
+}
+
+// revokeAccessToken records the access token's jti as revoked for the rest of its lifetime.
+// It returns false when the token is not a valid access token.
+func (h *Handler) revokeAccessToken(c *gin.Context, client *models.Client, token string) (bool, error) {
+	claims, issuer, err := h.validateAccessToken(c, token)
+	if errors.Is(err, errInvalidAccessToken) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if issuer.ID != client.ID {
+		return false, errTokenNotOwned
+	}
+
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		// Tokens issued before jti was introduced cannot be revoked individually
+		return false, nil
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return false, nil
+	}
+
+	// Key format: revoked_access_token:{jti}
+	// A token that has already expired is rejected anyway, and go-redis would store a negative TTL forever
+	ttl := time.Until(exp.Time)
+	if ttl <= 0 {
+		return true, nil
+	}
+	if err := h.RedisClient.Set(c, "revoked_access_token:"+jti, "revoked", ttl).Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// revokeRefreshToken blocks the refresh token. It returns false when the token is not a valid refresh token.
+func (h *Handler) revokeRefreshToken(c *gin.Context, client *models.Client, token string) (bool, error) {
+	validToken, claims, err := utils.ValidateRefreshToken(token, h.Config.JWTSecret)
+	if err != nil || !validToken.Valid {
+		return false, nil
+	}
+	if aud, _ := claims["aud"].(string); aud != client.ID.String() {
+		return false, errTokenNotOwned
+	}
+
+	if _, err := h.blockRefreshToken(c, token, claims); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"auth-system/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Browser SSO sessions live in Redis and are referenced by an HTTP-only cookie:
+// Key format: session:{id} -> JSON ssoSession
+// Each user's sessions are indexed so signing out ends all of them:
+// Key format: user_sessions:{user_id} -> set of session id
+
+const (
+	sessionCookieName      = "auth_session"
+	defaultSessionExpHours = 24
+
+	// Authentication method reference of RFC 8176 for a password login
+	amrPassword = "pwd"
+)
+
+// ssoSession is an authenticated browser session, shared by every client the user signs into
+type ssoSession struct {
+	ID       string   `json:"-"` // Taken from the cookie, not stored in the session itself
+	UserID   string   `json:"user_id"`
+	AuthTime int64    `json:"auth_time"`
+	AMR      []string `json:"amr,omitempty"`
+}
+
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+func userSessionsKey(userID string) string {
+	return "user_sessions:" + userID
+}
+
+func (h *Handler) sessionTTL() time.Duration {
+	if h.Config.SessionExpHours > 0 {
+		return time.Duration(h.Config.SessionExpHours) * time.Hour
+	}
+	return defaultSessionExpHours * time.Hour
+}
+
+// startSession creates an SSO session for a user who just authenticated and sets the session cookie.
+// A session the browser already had is replaced, so a session id is never reused across sign-ins.
+func (h *Handler) startSession(c *gin.Context, userID string, amr []string) (*ssoSession, error) {
+	if err := h.endCurrentSession(c); err != nil {
+		return nil, err
+	}
+
+	id, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	session := &ssoSession{ID: id, UserID: userID, AuthTime: time.Now().Unix(), AMR: amr}
+	jsonData, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := h.sessionTTL()
+	pipe := h.RedisClient.TxPipeline()
+	pipe.Set(c, sessionKey(id), jsonData, ttl)
+	pipe.SAdd(c, userSessionsKey(userID), id)
+	pipe.Expire(c, userSessionsKey(userID), ttl)
+	if _, err := pipe.Exec(c); err != nil {
+		return nil, err
+	}
+
+	h.setCookie(c, sessionCookieName, id, int(ttl.Seconds()))
+	return session, nil
+}
+
+// currentSession returns the SSO session of the browser, or nil when it has none or the session ended
+func (h *Handler) currentSession(c *gin.Context) (*ssoSession, error) {
+	id, err := c.Cookie(sessionCookieName)
+	if err != nil || id == "" {
+		return nil, nil
+	}
+
+	val, err := h.RedisClient.Get(c, sessionKey(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session ssoSession
+	if err := json.Unmarshal([]byte(val), &session); err != nil {
+		return nil, err
+	}
+	session.ID = id
+	return &session, nil
+}
+
+// endCurrentSession ends the SSO session of the browser, if it has one, and removes it from its user's index
+func (h *Handler) endCurrentSession(c *gin.Context) error {
+	id, err := c.Cookie(sessionCookieName)
+	if err != nil || id == "" {
+		return nil
+	}
+	session, err := h.currentSession(c)
+	if err != nil {
+		return err
+	}
+
+	pipe := h.RedisClient.TxPipeline()
+	pipe.Del(c, sessionKey(id))
+	if session != nil {
+		pipe.SRem(c, userSessionsKey(session.UserID), id)
+	}
+	_, err = pipe.Exec(c)
+	return err
+}
+
+// endUserSessions ends every SSO session of the user, in all browsers
+func (h *Handler) endUserSessions(ctx context.Context, userID string) error {
+	ids, err := h.RedisClient.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{userSessionsKey(userID)}
+	for _, id := range ids {
+		keys = append(keys, sessionKey(id))
+	}
+	return h.RedisClient.Del(ctx, keys...).Err()
+}
+
+// setCookie sets a secure, HTTP-only cookie scoped to the API base path.
+// A zero maxAge makes it a browser session cookie and a negative one deletes it.
+func (h *Handler) setCookie(c *gin.Context, name, value string, maxAge int) {
+	path := "/"
+	if u, err := url.Parse(h.Config.Issuer); err == nil && u.Path != "" {
+		path = u.Path
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		// Lax keeps the cookie on the top-level redirects from clients to the authorization endpoint
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	subjectTypePublic   = "public"
+	subjectTypePairwise = "pairwise"
+)
+
+var (
+	errPairwiseNotConfigured = errors.New("pairwise subject identifiers are not configured")
+	// errUnknownSubject is returned for a sub that does not identify a user for the client
+	errUnknownSubject = errors.New("unknown subject")
+)
+
+// sectorIdentifier returns the sector a pairwise client's subject identifiers are derived for. Sharing the
+// host of the redirect URIs would let any client registering that host correlate users, and there is no
+// verified sector_identifier_uri (OIDC Core Section 8.1) to prove who owns it, so every client is its own sector.
+func sectorIdentifier(client *models.Client) string {
+	return client.ID.String()
+}
+
+// subjectFor returns the sub the client knows the user by: the user ID, or for pairwise clients
+// an identifier derived from the client's sector, which is remembered so it can be mapped back
+func (h *Handler) subjectFor(ctx context.Context, client *models.Client, userID string) (string, error) {
+	if client.SubjectType != subjectTypePairwise {
+		return userID, nil
+	}
+	if h.Config.PairwiseSubjectSalt == "" {
+		return "", errPairwiseNotConfigured
+	}
+
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return "", err
+	}
+	sector := sectorIdentifier(client)
+	subject := utils.PairwiseSubject(sector, userID, h.Config.PairwiseSubjectSalt)
+
+	err = h.DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&models.PairwiseSubject{
+		Subject:          subject,
+		SectorIdentifier: sector,
+		UserID:           userUUID,
+	}).Error
+	if err != nil {
+		return "", err
+	}
+	return subject, nil
+}
+
+// subjectUserID maps a sub issued to the client back to the user ID.
+// It returns errUnknownSubject when the sub was not issued for the client's sector.
+func (h *Handler) subjectUserID(ctx context.Context, client *models.Client, subject string) (string, error) {
+	if client.SubjectType != subjectTypePairwise {
+		return subject, nil
+	}
+
+	var pairwise models.PairwiseSubject
+	err := h.DB.WithContext(ctx).Where("subject = ? AND sector_identifier = ?", subject, sectorIdentifier(client)).First(&pairwise).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", errUnknownSubject
+	}
+	if err != nil {
+		return "", err
+	}
+	return pairwise.UserID.String(), nil
+}
+
+// validateSubjectChange rejects changes a client makes to its own registration that affect how its users are
+// identified: the subject type once tokens naming them were issued, and the redirect URIs of a pairwise client,
+// which only the server administrator may change
+func validateSubjectChange(client *models.Client, subjectType string, redirectURIs []string) map[string]any {
+	if client.SubjectType == subjectTypePairwise && !slices.Equal(redirectURIs, client.RedirectURIs) {
+		return map[string]any{"redirect_uris": "Cannot be changed by a pairwise client"}
+	}
+	if client.UserTokensIssuedAt != nil && subjectType != client.SubjectType {
+		return map[string]any{"subject_type": "Cannot be changed once tokens were issued"}
+	}
+	return nil
+}
+
+// validateSubjectType checks the subject type of a client. Pairwise clients need the salt configured on the server.
+func (h *Handler) validateSubjectType(subjectType string) map[string]any {
+	switch subjectType {
+	case subjectTypePublic:
+		return nil
+	case subjectTypePairwise:
+	default:
+		return map[string]any{"subject_type": "Must be public or pairwise"}
+	}
+
+	if h.Config.PairwiseSubjectSalt == "" {
+		return map[string]any{"subject_type": "Pairwise subject identifiers are not enabled on this server"}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/gin-gonic/gin"
+)
+
+const layoutHTML = `
+{{define "header"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; background: #f4f5f7; display: flex; justify-content: center; padding-top: 10vh; }
+main { background: #fff; padding: 2rem; border-radius: 8px; width: 22rem; box-shadow: 0 1px 4px rgba(0,0,0,.1); }
+label { display: block; margin-top: 1rem; }
+input[type=email], input[type=password], input[type=text] { width: 100%; padding: .5rem; box-sizing: border-box; }
+button { margin-top: 1.5rem; padding: .5rem 1rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{end}}
+
+{{define "footer"}}
+</main>
+</body>
+</html>
+{{end}}
+
+{{define "hidden"}}{{range $name, $value := .}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}{{end}}
+`
+
+const loginHTML = `
+{{define "login"}}{{template "header" .}}
+<p>Sign in to continue to <strong>{{.ClientName}}</strong>.</p>
+<form method="post">
+{{template "hidden" .Hidden}}<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<label>Email <input type="email" name="email" value="{{.Email}}" required autofocus></label>
+<label>Password <input type="password" name="password" required></label>
+<button type="submit">Sign in</button>
+</form>
+{{template "footer" .}}{{end}}
+`
+
+const deviceHTML = `
+{{define "device"}}{{template "header" .}}
+{{if .ClientName}}<p><strong>{{.ClientName}}</strong> is requesting access to your account:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+{{else}}<p>Enter the code shown on your device and sign in to approve it. Approving grants the device the access it requested.</p>
+{{end}}<form method="post">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+{{if .ClientID}}<input type="hidden" name="client_id" value="{{.ClientID}}">
+{{end}}<label>Code <input type="text" name="user_code" value="{{.UserCode}}" required autocomplete="off"></label>
+<label>Email <input type="email" name="email" value="{{.Email}}" required></label>
+<label>Password <input type="password" name="password" required></label>
+<button type="submit" name="action" value="approve">Approve</button>
+<button type="submit" name="action" value="deny">Deny</button>
+</form>
+{{template "footer" .}}{{end}}
+`
+
+const consentHTML = `
+{{define "consent"}}{{template "header" .}}
+<p><strong>{{.ClientName}}</strong> is requesting access to your account:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="consent_request" value="{{.ConsentRequest}}">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<button type="submit" name="action" value="approve">Allow</button>
+<button type="submit" name="action" value="deny">Deny</button>
+</form>
+{{template "footer" .}}{{end}}
+`
+
+const logoutHTML = `
+{{define "logout"}}{{template "header" .}}
+<p>Sign out of <strong>{{.ClientName}}</strong> and every other application you signed into?</p>
+<form method="post" action="{{.Action}}">
+{{template "hidden" .Hidden}}<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<button type="submit" name="action" value="logout">Sign out</button>
+</form>
+{{template "footer" .}}{{end}}
+`
+
+const messageHTML = `
+{{define "message"}}{{template "header" .}}
+<p>{{.Message}}</p>
+{{template "footer" .}}{{end}}
+`
+
+type messagePage struct {
+	Title   string
+	Error   string
+	Message string
+}
+
+var pageTemplates = template.Must(template.New("pages").Parse(layoutHTML + loginHTML + consentHTML + deviceHTML + logoutHTML + messageHTML))
+
+// renderPage writes one of the server rendered HTML pages. The page is rendered before anything is
+// written, so a template error can still be reported as an internal error.
+func (h *Handler) renderPage(c *gin.Context, status int, name string, data any) {
+	var page bytes.Buffer
+	if err := pageTemplates.ExecuteTemplate(&page, name, data); err != nil {
+		h.RespondInternalError(c, err, 7001)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Data(status, "text/html; charset=utf-8", page.Bytes())
+}
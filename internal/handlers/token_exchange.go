@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"auth-system/internal/middleware"
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// The only token type that can be exchanged or issued
+	accessTokenType = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// tokenExchangeGrant implements RFC 8693 token exchange: a client trades an access token issued to it for one
+// addressed to another service, recording itself (or the subject of the actor token) as the acting party.
+// Which audiences a client may exchange into is configured per client.
+func (h *Handler) tokenExchangeGrant(c *gin.Context, client *models.Client, req *TokenRequest) {
+	if req.SubjectToken == "" || req.SubjectTokenType == "" {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_request", "subject_token and subject_token_type are required")
+		return
+	}
+	if req.SubjectTokenType != accessTokenType {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_request", "Unsupported subject_token_type")
+		return
+	}
+	if (req.ActorToken == "") != (req.ActorTokenType == "") {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_request", "actor_token and actor_token_type must be used together")
+		return
+	}
+	if req.ActorToken != "" && req.ActorTokenType != accessTokenType {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_request", "Unsupported actor_token_type")
+		return
+	}
+	if req.RequestedTokenType != "" && req.RequestedTokenType != accessTokenType {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_request", "Unsupported requested_token_type")
+		return
+	}
+	if req.Audience == "" {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_request", "audience is required")
+		return
+	}
+
+	// 1. Check the client's exchange policy
+	if !slices.Contains(client.TokenExchangeAudiences, req.Audience) {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_target", "The client may not exchange tokens for this audience")
+		return
+	}
+
+	// 2. Validate the subject token, which must be addressed to the requesting client
+	subjectClaims, _, err := h.validateAccessToken(c, req.SubjectToken)
+	if err != nil {
+		h.respondTokenError(c, http.StatusBadRequest, err, "invalid_grant", "Invalid subject_token")
+		return
+	}
+	if !h.checkExchangedToken(c, client, subjectClaims, req.Binding, "subject_token") {
+		return
+	}
+
+	// 3. Determine the acting party, nesting any earlier delegation of the subject token.
+	// Like the subject token, the actor token must have been issued to the requesting client.
+	act := map[string]any{"sub": client.ID.String()}
+	if req.ActorToken != "" {
+		actorClaims, _, err := h.validateAccessToken(c, req.ActorToken)
+		if err != nil {
+			h.respondTokenError(c, http.StatusBadRequest, err, "invalid_grant", "Invalid actor_token")
+			return
+		}
+		if !h.checkExchangedToken(c, client, actorClaims, req.Binding, "actor_token") {
+			return
+		}
+		act["sub"] = actorClaims["sub"]
+	}
+	if prior, ok := subjectClaims["act"].(map[string]any); ok {
+		act["act"] = prior
+	}
+
+	// 4. The exchanged token can only narrow the subject token's scope
+	scope, _ := subjectClaims["scope"].(string)
+	if req.Scope != "" {
+		if !utils.ScopeSubset(req.Scope, scope) {
+			h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_scope", "Requested scope exceeds the subject_token's scope")
+			return
+		}
+		scope = req.Scope
+	}
+
+	// 5. Generate the delegated Access Token
+	subject, _ := subjectClaims["sub"].(string)
+	authTime, _ := subjectClaims["auth_time"].(float64)
+	accessToken, err := utils.GenerateAccessToken(client.PrivateKey, utils.AccessTokenClaims{
+		Issuer:   h.Config.Issuer,
+		Subject:  subject,
+		ClientID: client.ID.String(),
+		Audience: req.Audience,
+		Scope:    scope,
+		AuthTime: int64(authTime),
+		Act:      act,
+		JKT:      req.Binding.JKT,
+		X5TS256:  req.Binding.X5TS256,
+	}, h.Config.AccessTokenExp)
+	if err != nil {
+		h.RespondInternalError(c, err, 16001)
+		return
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("Token exchanged", "client_id", client.ID, "audience", req.Audience, "sub", subject, "scope", scope, "trace_id", traceID)
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":      accessToken,
+		"issued_token_type": accessTokenType,
+		"token_type":        tokenType(req.Binding.JKT),
+		"expires_in":        h.Config.AccessTokenExp * 60,
+		"scope":             scope,
+	})
+}
+
+// checkExchangedToken checks that a token presented for exchange was issued to the requesting client,
+// and that a sender-constrained token is presented by its holder. name is the request parameter it came from.
+func (h *Handler) checkExchangedToken(c *gin.Context, client *models.Client, claims jwt.MapClaims, binding tokenBinding, name string) bool {
+	if !tokenAddressedTo(claims, client.ID.String()) {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_grant", name+" was not issued to this client")
+		return false
+	}
+	if boundJKT := utils.ConfirmationJKT(claims); boundJKT != "" && boundJKT != binding.JKT {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_dpop_proof", name+" is bound to a different DPoP key")
+		return false
+	}
+	if boundX5T := utils.ConfirmationX5T(claims); boundX5T != "" && boundX5T != binding.X5TS256 {
+		h.respondTokenError(c, http.StatusBadRequest, nil, "invalid_grant", name+" is bound to a different client certificate")
+		return false
+	}
+	return true
+}
+
+// tokenAddressedTo reports whether the token's audience includes the client
+func tokenAddressedTo(claims jwt.MapClaims, clientID string) bool {
+	aud, err := claims.GetAudience()
+	return err == nil && slices.Contains(aud, clientID)
+}
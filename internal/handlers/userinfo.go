@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"auth-system/internal/middleware"
+	"auth-system/internal/models"
+	"auth-system/internal/utils"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UserInfo implements the OpenID Connect UserInfo endpoint. The standard claims returned
+// depend on the scopes granted to the access token: profile and email.
+func (h *Handler) UserInfo(c *gin.Context) {
+	claims, userID, ok := h.authenticateUser(c)
+	if !ok {
+		return
+	}
+
+	if !h.requireScope(c, claims, "openid") {
+		return
+	}
+	scope, _ := claims["scope"].(string)
+
+	// 1. Load the user the token was issued for
+	var user models.User
+	if err := h.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			setAuthenticateChallenge(c, authorizationScheme(c), "invalid_token", "The token subject is not a user")
+			h.RespondError(c, http.StatusUnauthorized, err, "Invalid token")
+			return
+		}
+		h.RespondInternalError(c, err, 17001)
+		return
+	}
+
+	// 2. Release the claims of the granted scopes
+	// The sub is the one the client knows the user by, which is pairwise for pairwise clients
+	response := gin.H{"sub": claims["sub"]}
+	if utils.HasScope(scope, "profile") {
+		response["given_name"] = user.FirstName
+		response["family_name"] = user.LastName
+		response["name"] = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		response["updated_at"] = user.UpdatedAt.Unix()
+	}
+	if utils.HasScope(scope, "email") {
+		response["email"] = user.Email
+		response["email_verified"] = user.Verified
+	}
+
+	traceID, _ := c.Get(middleware.TraceIDKey)
+	slog.Info("UserInfo requested", "user_id", user.ID, "client_id", claims["client_id"], "trace_id", traceID)
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"slices"
 	"time"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -18,15 +19,69 @@ type User struct {
 }
 
 type Client struct {
+	ID                                    uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Name                                  string    `gorm:"uniqueIndex;not null"`
+	Secret                                string    `gorm:"not null"` // Encrypted
+	PrivateKey                            string    `gorm:"not null"` // PEM encoded
+	PublicKey                             string    `gorm:"not null"` // PEM encoded
+	RedirectURIs                          []string  `gorm:"serializer:json"`
+	Scopes                                string    `gorm:"not null;default:'openid profile email'"` // Space-delimited allowed scopes
+	TokenEndpointAuthMethod               string    `gorm:"not null;default:'client_secret_basic'"`
+	JWKS                                  string    // JSON Web Key Set for private_key_jwt assertions and self-signed certificates
+	GrantTypes                            []string  `gorm:"serializer:json"` // Empty allows every grant type
+	RegistrationAccessToken               string    // Encrypted, only set for dynamically registered clients
+	RequirePushedAuthorizationRequests    bool      `gorm:"not null;default:false"`
+	TLSClientAuthSubjectDN                string    // Subject DN of the client certificate for tls_client_auth
+	TLSClientCertificateBoundAccessTokens bool      `gorm:"not null;default:false"`
+	TokenExchangeAudiences                []string  `gorm:"serializer:json"` // Client IDs this client may exchange tokens into
+	PostLogoutRedirectURIs                []string  `gorm:"serializer:json"`
+	BackchannelLogoutURI                  string
+	RequestURIs                           []string  `gorm:"serializer:json"` // Request object URLs the server may fetch
+	RequireSignedRequestObject            bool      `gorm:"not null;default:false"`
+	AllowedResources                      []string  `gorm:"serializer:json"` // Identifiers of the API resources the client may request tokens for
+	SubjectType                           string    `gorm:"not null;default:'public'"` // public, or pairwise for a sub derived per sector
+	UserTokensIssuedAt                    *time.Time // Set when the first token naming a user is issued, fixing the subject type and sector
+	CreatedAt                             time.Time
+	UpdatedAt                             time.Time
+}
+
+// AllowsGrantType reports whether the client may use the grant type.
+// Clients registered before grant types were recorded may use all of them.
+func (c *Client) AllowsGrantType(grantType string) bool {
+	return len(c.GrantTypes) == 0 || slices.Contains(c.GrantTypes, grantType)
+}
+
+// Consent records the scopes a user has authorized a client to access
+type Consent struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_consent_user_client"`
+	ClientID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_consent_user_client"`
+	User      User      `gorm:"constraint:OnDelete:CASCADE"`
+	Client    Client    `gorm:"constraint:OnDelete:CASCADE"`
+	Scopes    string    `gorm:"not null"` // Space-delimited consented scopes
+	GrantedAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// APIResource is a protected API that access tokens can be issued for (RFC 8707)
+type APIResource struct {
 	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	Name       string    `gorm:"uniqueIndex;not null"`
-	Secret     string    `gorm:"not null"` // Encrypted
-	PrivateKey string    `gorm:"not null"` // PEM encoded
-	PublicKey  string    `gorm:"not null"` // PEM encoded
+	Identifier string    `gorm:"uniqueIndex;not null"` // Absolute URI used as the resource parameter and the token audience
+	Name       string    `gorm:"not null"`
+	Scopes     string    // Space-delimited scopes the API understands
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
 }
 
+// PairwiseSubject maps a pairwise subject identifier back to the user it was derived for
+type PairwiseSubject struct {
+	Subject          string    `gorm:"primary_key"`
+	SectorIdentifier string    `gorm:"not null"` // Host of the redirect URIs of the clients sharing the identifier
+	UserID           uuid.UUID `gorm:"type:uuid;not null;index"`
+	User             User      `gorm:"constraint:OnDelete:CASCADE"`
+	CreatedAt        time.Time
+}
+
 func (user *User) BeforeCreate(tx *gorm.DB) (err error) {
 	if user.ID == uuid.Nil {
 		user.ID = uuid.New()
@@ -40,3 +95,17 @@ func (client *Client) BeforeCreate(tx *gorm.DB) (err error) {
 	}
 	return
 }
+
+func (consent *Consent) BeforeCreate(tx *gorm.DB) (err error) {
+	if consent.ID == uuid.Nil {
+		consent.ID = uuid.New()
+	}
+	return
+}
+
+func (resource *APIResource) BeforeCreate(tx *gorm.DB) (err error) {
+	if resource.ID == uuid.Nil {
+		resource.ID = uuid.New()
+	}
+	return
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// LoadCertPool reads the PEM encoded CA certificates of a file into a pool
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no certificates found in " + path)
+	}
+	return pool, nil
+}
+
+// CertificateThumbprint is the base64url SHA-256 thumbprint of a certificate, as used by the x5t#S256 claim
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ConfirmationX5T returns the certificate thumbprint a token is bound to, or an empty string
+func ConfirmationX5T(claims jwt.MapClaims) string {
+	cnf, _ := claims["cnf"].(map[string]any)
+	x5t, _ := cnf["x5t#S256"].(string)
+	return x5t
+}
@@ -12,6 +12,8 @@ import (
 	"encoding/pem"
 	"errors"
 	"io"
+	"math/big"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -114,6 +116,12 @@ func GenerateRandomString(n int) (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
+// Pairwise Subject Identifier (OpenID Connect Core Section 8.1)
+func PairwiseSubject(sectorIdentifier, userID, salt string) string {
+	sum := sha256.Sum256([]byte(sectorIdentifier + userID + salt))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
 // Random Digits
 func GenerateRandomDigits(n int) (string, error) {
 	bytes := make([]byte, n)
@@ -126,6 +134,37 @@ func GenerateRandomDigits(n int) (string, error) {
 	return string(bytes), nil
 }
 
+// User Code for the Device Authorization Grant (RFC 8628 Section 6.1)
+// Uses consonants only to avoid ambiguous characters and accidental words, formatted as XXXX-XXXX.
+const userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+
+func GenerateUserCode() (string, error) {
+	code := make([]byte, 8)
+	max := big.NewInt(int64(len(userCodeCharset)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeCharset[n.Int64()]
+	}
+	return string(code[:4]) + "-" + string(code[4:]), nil
+}
+
+// NormalizeUserCode uppercases a user entered code and restores the XXXX-XXXX format
+func NormalizeUserCode(input string) string {
+	var code []rune
+	for _, r := range strings.ToUpper(input) {
+		if strings.ContainsRune(userCodeCharset, r) {
+			code = append(code, r)
+		}
+	}
+	if len(code) != 8 {
+		return string(code)
+	}
+	return string(code[:4]) + "-" + string(code[4:])
+}
+
 // PKCE Verification (S256)
 func VerifyCodeChallenge(challenge, verifier string) bool {
 	s256 := sha256.Sum256([]byte(verifier))
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ValidateDPoPProof verifies the signature of an RFC 9449 DPoP proof with the public key in its header.
+// It returns the proof's claims and the JWK thumbprint of that key.
+func ValidateDPoPProof(proof string) (jwt.MapClaims, string, error) {
+	var jkt string
+	token, err := jwt.Parse(proof, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, errors.New("typ must be dpop+jwt")
+		}
+
+		header, ok := token.Header["jwk"].(map[string]any)
+		if !ok {
+			return nil, errors.New("jwk header is required")
+		}
+		if _, ok := header["d"]; ok {
+			return nil, errors.New("jwk header must not contain a private key")
+		}
+
+		data, err := json.Marshal(header)
+		if err != nil {
+			return nil, err
+		}
+		var jwk JWK
+		if err := json.Unmarshal(data, &jwk); err != nil {
+			return nil, err
+		}
+
+		key, err := jwk.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		jkt, err = JWKThumbprint(jwk)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}, jwt.WithValidMethods(AsymmetricSigningAlgs))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		return claims, jkt, nil
+	}
+
+	return nil, "", errors.New("invalid token")
+}
+
+// AccessTokenHash is the ath claim of a DPoP proof presented with the access token
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ConfirmationJKT returns the DPoP key thumbprint a token is bound to, or an empty string
+func ConfirmationJKT(claims jwt.MapClaims) string {
+	cnf, _ := claims["cnf"].(map[string]any)
+	jkt, _ := cnf["jkt"].(string)
+	return jkt
+}
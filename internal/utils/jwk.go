@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type JWK struct {
+	Kty string   `json:"kty"`
+	Use string   `json:"use,omitempty"`
+	Alg string   `json:"alg,omitempty"`
+	Kid string   `json:"kid,omitempty"`
+	N   string   `json:"n,omitempty"`
+	E   string   `json:"e,omitempty"`
+	Crv string   `json:"crv,omitempty"`
+	X   string   `json:"x,omitempty"`
+	Y   string   `json:"y,omitempty"`
+	X5c []string `json:"x5c,omitempty"` // Base64 DER certificate chain, may stand in for the key members
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// ParseJWKS parses a JSON Web Key Set and checks that every key in it is a usable public key
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var jwks JWKS
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+	if len(jwks.Keys) == 0 {
+		return nil, errors.New("key set has no keys")
+	}
+	for _, key := range jwks.Keys {
+		if _, err := key.PublicKey(); err != nil {
+			return nil, err
+		}
+	}
+	return &jwks, nil
+}
+
+// PublicKey converts the JWK into an *rsa.PublicKey or *ecdsa.PublicKey.
+// A JWK carrying only a certificate (x5c) uses the certificate's key.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	if len(k.X5c) > 0 && k.N == "" && k.X == "" {
+		der, err := base64.StdEncoding.DecodeString(k.X5c[0])
+		if err != nil {
+			return nil, errors.New("invalid x5c certificate")
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		switch cert.PublicKey.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			return cert.PublicKey, nil
+		}
+		return nil, errors.New("unsupported x5c key type")
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil || len(n) == 0 {
+			return nil, errors.New("invalid RSA modulus")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("unsupported curve " + k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, errors.New("invalid EC x coordinate")
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, errors.New("invalid EC y coordinate")
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		// Rejects points that are not on the curve
+		if _, err := key.ECDH(); err != nil {
+			return nil, err
+		}
+		return key, nil
+	default:
+		return nil, errors.New("unsupported key type " + k.Kty)
+	}
+}
+
+// RSAPublicKeyToJWK converts an RSA public key into a signing JWK whose kid is its RFC 7638 thumbprint
+func RSAPublicKeyToJWK(key *rsa.PublicKey) (JWK, error) {
+	jwk := JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+
+	kid, err := JWKThumbprint(jwk)
+	if err != nil {
+		return JWK{}, err
+	}
+	jwk.Kid = kid
+	return jwk, nil
+}
+
+// PublicKeyPEMToJWK converts a PEM encoded RSA public key (as stored on a client) into a JWK
+func PublicKeyPEMToJWK(publicKeyPEM string) (JWK, error) {
+	key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(publicKeyPEM))
+	if err != nil {
+		return JWK{}, err
+	}
+	return RSAPublicKeyToJWK(key)
+}
+
+// JWKThumbprint computes the RFC 7638 SHA-256 thumbprint of a JWK
+func JWKThumbprint(jwk JWK) (string, error) {
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		// Required members in lexicographic order
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		return "", errors.New("unsupported key type")
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
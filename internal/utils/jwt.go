@@ -2,12 +2,29 @@ package utils
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-func GenerateAccessToken(privateKeyPEM string, userID, clientID string, expMinutes int) (string, error) {
+// AccessTokenType is the typ header of JWT access tokens (RFC 9068 Section 2.1)
+const AccessTokenType = "at+jwt"
+
+type AccessTokenClaims struct {
+	Issuer   string
+	Subject  string
+	ClientID string // Client the token is issued to, whose key signs it
+	Audience string // Defaults to ClientID
+	Scope    string
+	AuthTime int64          // When the user authenticated, if known
+	Act      map[string]any // Delegation chain of RFC 8693 Section 4.1, if any
+	JKT      string         // Thumbprint of the DPoP key the token is bound to, if any
+	X5TS256  string         // Thumbprint of the client certificate the token is bound to, if any
+}
+
+func GenerateAccessToken(privateKeyPEM string, atClaims AccessTokenClaims, expMinutes int) (string, error) {
 	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKeyPEM))
 	if err != nil {
 		return "", err
@@ -15,30 +32,208 @@ func GenerateAccessToken(privateKeyPEM string, userID, clientID string, expMinut
 
 	now := time.Now()
 	claims := jwt.MapClaims{
-		"sub": userID,
-		"iat": now.Unix(),
-		"exp": now.Add(time.Duration(expMinutes) * time.Minute).Unix(),
-		"aud": clientID,
+		"iss":       atClaims.Issuer,
+		"jti":       uuid.New().String(),
+		"sub":       atClaims.Subject,
+		"iat":       now.Unix(),
+		"nbf":       now.Unix(),
+		"exp":       now.Add(time.Duration(expMinutes) * time.Minute).Unix(),
+		"aud":       atClaims.ClientID,
+		"client_id": atClaims.ClientID,
+	}
+	if atClaims.Audience != "" {
+		claims["aud"] = atClaims.Audience
+	}
+	if atClaims.Scope != "" {
+		claims["scope"] = atClaims.Scope
+	}
+	if atClaims.AuthTime != 0 {
+		claims["auth_time"] = atClaims.AuthTime
+	}
+	if atClaims.Act != nil {
+		claims["act"] = atClaims.Act
+	}
+	cnf := map[string]string{}
+	if atClaims.JKT != "" {
+		cnf["jkt"] = atClaims.JKT
+	}
+	if atClaims.X5TS256 != "" {
+		cnf["x5t#S256"] = atClaims.X5TS256
+	}
+	if len(cnf) > 0 {
+		claims["cnf"] = cnf
+	}
+
+	jwk, err := RSAPublicKeyToJWK(&key.PublicKey)
+	if err != nil {
+		return "", err
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["typ"] = AccessTokenType
+	token.Header["kid"] = jwk.Kid
 	return token.SignedString(key)
 }
 
-func GenerateRefreshToken(secretKey string, userID, clientID string, expDays int) (string, error) {
+type IDTokenClaims struct {
+	Issuer        string
+	Subject       string
+	Audience      string
+	AuthTime      int64
+	AMR           []string // Authentication methods of RFC 8176
+	Nonce         string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+func GenerateIDToken(privateKeyPEM string, idClaims IDTokenClaims, expMinutes int) (string, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKeyPEM))
+	if err != nil {
+		return "", err
+	}
+
 	now := time.Now()
 	claims := jwt.MapClaims{
-		"sub": userID,
+		"iss":            idClaims.Issuer,
+		"sub":            idClaims.Subject,
+		"aud":            idClaims.Audience,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Duration(expMinutes) * time.Minute).Unix(),
+		"auth_time":      idClaims.AuthTime,
+		"email":          idClaims.Email,
+		"email_verified": idClaims.EmailVerified,
+		"given_name":     idClaims.GivenName,
+		"family_name":    idClaims.FamilyName,
+	}
+	if idClaims.Nonce != "" {
+		claims["nonce"] = idClaims.Nonce
+	}
+	if len(idClaims.AMR) > 0 {
+		claims["amr"] = idClaims.AMR
+	}
+
+	jwk, err := RSAPublicKeyToJWK(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = jwk.Kid
+	return token.SignedString(key)
+}
+
+// ValidateIDTokenHint verifies the signature and issuer of an ID token this server issued.
+// Expired tokens are accepted, as an id_token_hint only identifies the user and client.
+func ValidateIDTokenHint(tokenString, publicKeyPEM, issuer string) (jwt.MapClaims, error) {
+	key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(publicKeyPEM))
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if iss, _ := claims.GetIssuer(); iss != issuer {
+		return nil, errors.New("invalid issuer")
+	}
+	return claims, nil
+}
+
+// BackchannelLogoutEvent is the events member of OIDC back-channel logout tokens
+const BackchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+type LogoutTokenClaims struct {
+	Issuer   string
+	Subject  string
+	Audience string
+}
+
+// GenerateLogoutToken creates the logout token of OpenID Connect Back-Channel Logout 1.0 Section 2.4
+func GenerateLogoutToken(privateKeyPEM string, ltClaims LogoutTokenClaims, expMinutes int) (string, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKeyPEM))
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":    ltClaims.Issuer,
+		"sub":    ltClaims.Subject,
+		"aud":    ltClaims.Audience,
+		"iat":    now.Unix(),
+		"exp":    now.Add(time.Duration(expMinutes) * time.Minute).Unix(),
+		"jti":    uuid.New().String(),
+		"events": map[string]any{BackchannelLogoutEvent: map[string]any{}},
+	}
+
+	jwk, err := RSAPublicKeyToJWK(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["typ"] = "logout+jwt"
+	token.Header["kid"] = jwk.Kid
+	return token.SignedString(key)
+}
+
+type RefreshTokenClaims struct {
+	Subject  string
+	ClientID string
+	JTI      string
+	FamilyID string // Links all tokens rotated from the same original grant
+	Scope    string // Scope of the original grant
+	Resource string // API resource of the original grant, if any
+	JKT      string // Thumbprint of the DPoP key the token is bound to, if any
+	AuthTime int64  // When the user authenticated for the original grant, if known
+}
+
+func GenerateRefreshToken(secretKey string, rtClaims RefreshTokenClaims, expDays int) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"jti": rtClaims.JTI,
+		"fid": rtClaims.FamilyID,
+		"sub": rtClaims.Subject,
 		"iat": now.Unix(),
 		"exp": now.Add(time.Duration(expDays) * 24 * time.Hour).Unix(),
-		"aud": clientID,
+		"aud": rtClaims.ClientID,
+	}
+	if rtClaims.Scope != "" {
+		claims["scope"] = rtClaims.Scope
+	}
+	if rtClaims.Resource != "" {
+		claims["resource"] = rtClaims.Resource
+	}
+	if rtClaims.JKT != "" {
+		claims["cnf"] = map[string]string{"jkt": rtClaims.JKT}
+	}
+	if rtClaims.AuthTime != 0 {
+		claims["auth_time"] = rtClaims.AuthTime
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(secretKey))
 }
 
-func ValidateAccessToken(tokenString string, publicKeyPEM string) (*jwt.Token, jwt.MapClaims, error) {
+// AccessTokenValidation is what ValidateAccessToken checks besides the signature and lifetime
+type AccessTokenValidation struct {
+	Issuer    string
+	Audiences []string      // The token must be addressed to at least one of them
+	Leeway    time.Duration // Allowed clock skew for exp, nbf and iat
+}
+
+// ValidateAccessToken verifies an RFC 9068 JWT access token: its typ header, signature, issuer, audience and lifetime
+func ValidateAccessToken(tokenString string, publicKeyPEM string, opts AccessTokenValidation) (*jwt.Token, jwt.MapClaims, error) {
 	key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(publicKeyPEM))
 	if err != nil {
 		return nil, nil, err
@@ -48,8 +243,17 @@ func ValidateAccessToken(tokenString string, publicKeyPEM string) (*jwt.Token, j
 		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
 			return nil, errors.New("unexpected signing method")
 		}
+		if typ, _ := token.Header["typ"].(string); !strings.EqualFold(strings.TrimPrefix(typ, "application/"), AccessTokenType) {
+			return nil, errors.New("unexpected token type")
+		}
 		return key, nil
-	})
+	},
+		jwt.WithIssuer(opts.Issuer),
+		jwt.WithAudience(opts.Audiences...),
+		jwt.WithLeeway(opts.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
 
 	if err != nil {
 		return nil, nil, err
@@ -80,3 +284,50 @@ func ValidateRefreshToken(tokenString string, secretKey string) (*jwt.Token, jwt
 
 	return nil, nil, errors.New("invalid token")
 }
+
+// AsymmetricSigningAlgs are the JWS algorithms accepted for JWTs signed by clients
+var AsymmetricSigningAlgs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// ValidateClientAssertion verifies the signature and expiry of an RFC 7523 client assertion
+// against the client's key set. When the assertion names a kid only that key is tried.
+func ValidateClientAssertion(assertion string, jwks *JWKS) (jwt.MapClaims, error) {
+	return validateClientSignedJWT(assertion, jwks)
+}
+
+// ValidateRequestObject verifies the signature and expiry of an RFC 9101 request object against the client's key set
+func ValidateRequestObject(requestObject string, jwks *JWKS) (jwt.MapClaims, error) {
+	return validateClientSignedJWT(requestObject, jwks)
+}
+
+// validateClientSignedJWT verifies a JWT signed with one of the client's asymmetric keys
+func validateClientSignedJWT(tokenString string, jwks *JWKS) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		var keys jwt.VerificationKeySet
+		for _, jwk := range jwks.Keys {
+			if (kid != "" && jwk.Kid != kid) || (jwk.Use != "" && jwk.Use != "sig") {
+				continue
+			}
+			key, err := jwk.PublicKey()
+			if err != nil {
+				continue
+			}
+			keys.Keys = append(keys.Keys, key)
+		}
+		if len(keys.Keys) == 0 {
+			return nil, errors.New("no matching key")
+		}
+		return keys, nil
+	}, jwt.WithValidMethods(AsymmetricSigningAlgs), jwt.WithExpirationRequired())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid token")
+}
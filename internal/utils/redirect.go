@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"net/url"
+)
+
+// ValidateRedirectURI checks that a redirect URI is acceptable for registration
+func ValidateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if !u.IsAbs() {
+		return errors.New("must be an absolute URI")
+	}
+	if (u.Scheme == "http" || u.Scheme == "https") && u.Host == "" {
+		return errors.New("must contain a host")
+	}
+	if u.Fragment != "" {
+		return errors.New("must not contain a fragment")
+	}
+	return nil
+}
+
+// MatchRedirectURI reports whether the candidate exactly matches one of the registered redirect URIs.
+// Per RFC 8252 Section 7.3, http loopback IP redirects match regardless of port.
+func MatchRedirectURI(registered []string, candidate string) bool {
+	for _, uri := range registered {
+		if uri == candidate {
+			return true
+		}
+	}
+
+	c, err := url.Parse(candidate)
+	if err != nil || !isLoopbackRedirect(c) {
+		return false
+	}
+	for _, uri := range registered {
+		r, err := url.Parse(uri)
+		if err != nil || !isLoopbackRedirect(r) {
+			continue
+		}
+		if r.Hostname() == c.Hostname() && r.Path == c.Path && r.RawQuery == c.RawQuery {
+			return true
+		}
+	}
+	return false
+}
+
+func isLoopbackRedirect(u *url.URL) bool {
+	if u.Scheme != "http" {
+		return false
+	}
+	ip := net.ParseIP(u.Hostname())
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+// ParseScope splits a space-delimited OAuth scope string into its scope tokens
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// ValidateScope checks that every scope token only uses the characters allowed by RFC 6749 Section 3.3
+func ValidateScope(scope string) error {
+	for _, token := range ParseScope(scope) {
+		for _, r := range token {
+			if r < 0x21 || r == 0x22 || r == 0x5C || r > 0x7E {
+				return errors.New("invalid character in scope " + token)
+			}
+		}
+	}
+	return nil
+}
+
+// ScopeSubset reports whether every requested scope is contained in the allowed scope string
+func ScopeSubset(requested, allowed string) bool {
+	allowedSet := make(map[string]bool)
+	for _, s := range ParseScope(allowed) {
+		allowedSet[s] = true
+	}
+	for _, s := range ParseScope(requested) {
+		if !allowedSet[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// HasScope reports whether the scope string contains the given scope
+func HasScope(scope, name string) bool {
+	for _, s := range ParseScope(scope) {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterScope returns the scopes of the scope string that are also in the allowed scope string
+func FilterScope(scope, allowed string) string {
+	var filtered []string
+	for _, s := range ParseScope(scope) {
+		if HasScope(allowed, s) {
+			filtered = append(filtered, s)
+		}
+	}
+	return strings.Join(filtered, " ")
+}
+
+// MergeScopes returns the union of two scope strings, keeping the order in which scopes first appear
+func MergeScopes(a, b string) string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, s := range append(ParseScope(a), ParseScope(b)...) {
+		if !seen[s] {
+			seen[s] = true
+			merged = append(merged, s)
+		}
+	}
+	return strings.Join(merged, " ")
+}
@@ -0,0 +1,42 @@
+#!/bin/sh
+# Generates certificates for trying mutual-TLS client authentication locally:
+#   ca.crt          CA to use as TLS_CLIENT_CA_FILE
+#   server.crt/key  server certificate for localhost, TLS_CERT_FILE and TLS_KEY_FILE
+#   client.crt/key  CA-issued client certificate for tls_client_auth
+#   self-signed.crt/key  self-signed client certificate for self_signed_tls_client_auth
+#
+# Usage: scripts/generate-mtls-certs.sh [output directory] [client name]
+set -eu
+
+OUT="${1:-certs}"
+CLIENT="${2:-example-client}"
+DAYS=365
+
+mkdir -p "$OUT"
+cd "$OUT"
+
+# CA
+openssl req -x509 -newkey rsa:2048 -nodes -days "$DAYS" \
+	-keyout ca.key -out ca.crt -subj "/CN=Auth Server Test CA"
+
+# Server certificate
+openssl req -newkey rsa:2048 -nodes -keyout server.key -out server.csr -subj "/CN=localhost"
+printf "subjectAltName=DNS:localhost,IP:127.0.0.1\nextendedKeyUsage=serverAuth\n" > server.ext
+openssl x509 -req -in server.csr -CA ca.crt -CAkey ca.key -CAcreateserial -days "$DAYS" \
+	-extfile server.ext -out server.crt
+
+# CA-issued client certificate
+openssl req -newkey rsa:2048 -nodes -keyout client.key -out client.csr -subj "/O=Example/CN=$CLIENT"
+printf "extendedKeyUsage=clientAuth\n" > client.ext
+openssl x509 -req -in client.csr -CA ca.crt -CAkey ca.key -CAcreateserial -days "$DAYS" \
+	-extfile client.ext -out client.crt
+
+# Self-signed client certificate
+openssl req -x509 -newkey rsa:2048 -nodes -days "$DAYS" \
+	-keyout self-signed.key -out self-signed.crt -subj "/CN=$CLIENT"
+
+rm -f server.csr server.ext client.csr client.ext ca.srl
+
+echo "tls_client_auth_subject_dn: $(openssl x509 -in client.crt -noout -subject -nameopt RFC2253 | sed 's/^subject=//')"
+echo "jwks for self_signed_tls_client_auth:"
+echo "{\"keys\":[{\"kty\":\"RSA\",\"x5c\":[\"$(openssl x509 -in self-signed.crt -outform der | base64 | tr -d '\n')\"]}]}"